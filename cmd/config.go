@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/config"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/inventory"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/tracing"
+	"github.com/spf13/cobra"
+)
+
+// newConfigCommand builds the `config` command printing the effective
+// configuration with secrets redacted, then the invalid settings
+func newConfigCommand(cfg *config.Config) *cobra.Command {
+	return &cobra.Command{
+		Use:   "config",
+		Short: "Print the effective configuration, secrets redacted, and validate it",
+		Args:  cobra.NoArgs,
+		Run: exitOnError(func(cmd *cobra.Command, args []string) error {
+			out, err := cfg.Redacted()
+			if err != nil {
+				return err
+			}
+			fmt.Fprint(cmd.OutOrStdout(), out)
+
+			_, allocationErr := allocationStrategy(*cfg)
+			_, tracingErr := tracingConfig(*cfg)
+			if err := errors.Join(cfg.Validate(), allocationErr, tracingErr); err != nil {
+				return fmt.Errorf("invalid configuration:\n%w", err)
+			}
+			return nil
+		}),
+	}
+}
+
+// allocationStrategy parses the configured warehouse allocation strategy
+func allocationStrategy(cfg config.Config) (inventory.AllocationStrategy, error) {
+	strategy, err := inventory.ParseAllocationStrategy(cfg.Warehouse.Allocation)
+	if err != nil {
+		return "", fmt.Errorf("warehouse.allocation: %w", err)
+	}
+	return strategy, nil
+}
+
+// tracingConfig parses the configured span exporter
+func tracingConfig(cfg config.Config) (tracing.Config, error) {
+	exporter, err := tracing.ParseExporter(cfg.Tracing.Exporter)
+	if err != nil {
+		return tracing.Config{}, fmt.Errorf("tracing.exporter: %w", err)
+	}
+	return tracing.Config{ServiceName: cfg.Tracing.ServiceName, Exporter: exporter, File: cfg.Tracing.File}, nil
+}
@@ -2,15 +2,21 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
-	"time"
 
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/config"
 	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/db"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/health"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/logging"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/media"
+	localMetrics "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/metrics"
 	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/operation"
 	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/rabbitmq"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/tracing"
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/danielgtaylor/huma/v2/adapters/humachi"
 	"github.com/danielgtaylor/huma/v2/humacli"
@@ -22,88 +28,219 @@ import (
 	"gorm.io/gorm"
 )
 
-// Options for CLI
+// Options for CLI, overriding the configuration file and environment
 type Options struct {
-	Port int `help:"Port to listen on" short:"p" default:"8083"`
+	Config string `help:"Path to a YAML configuration file"`
+	Port   int    `help:"Port to listen on, overrides http.port" short:"p"`
 }
 
 var dbConn *gorm.DB
 
 func main() {
 	_ = godotenv.Load()
-	dbConn = db.Init()
-	// RabbitMQ setup
-	var conn *amqp.Connection
-	var ch *amqp.Channel
-	disableRabbit := os.Getenv("DISABLE_RABBITMQ") == "true"
-
-	if !disableRabbit {
-		conn, ch = rabbitmq.Connect()
-		eventRouter := rabbitmq.SetupEventHandlers(dbConn)
-		go func() {
-			if _, err := rabbitmq.StartListening(ch, eventRouter); err != nil {
-				log.Fatalf("Failed to start event listener: %v", err)
-			}
-		}()
-	} else {
-		log.Println("DISABLE_RABBITMQ=true, skipping RabbitMQ connection")
-	}
+
+	var cfg config.Config
 
 	// CLI & API setup
 	cli := humacli.New(func(hooks humacli.Hooks, options *Options) {
-		// Create a new router & API
-		router := chi.NewMux()
+		var err error
+		cfg, err = config.Load(options.Config)
+		if err != nil {
+			fatal(slog.Default(), "Failed to load configuration", err)
+		}
+		if options.Port != 0 {
+			cfg.HTTP.Port = options.Port
+		}
 
-		router.Use(middleware.Logger)
-		router.Use(middleware.Recoverer)
-		router.Use(middleware.Compress(5))
+		logger := logging.New(os.Stdout, logging.ParseLevel(cfg.Log.Level))
+		slog.SetDefault(logger)
 
-		router.Use(metrics.Collector(metrics.CollectorOpts{
-			Host:  false,
-			Proto: true,
-			Skip: func(r *http.Request) bool {
-				return r.Method != "OPTIONS"
-			},
-		}))
+		var server *http.Server
+		var conn *amqp.Connection
+		var ch *amqp.Channel
+		var consumer *rabbitmq.Consumer
+		var publisher *rabbitmq.Publisher
+		shutdownTracing := func(context.Context) error { return nil }
+		// Cancelled on shutdown, stopping the background jobs
+		background, stopBackground := context.WithCancel(context.Background())
 
-		router.Handle("/metrics", metrics.Handler())
+		// OnStart: connect to the dependencies, then blocking ListenAndServe
+		hooks.OnStart(func() {
+			// Other commands validate the sections they use
+			allocation, allocationErr := allocationStrategy(cfg)
+			tracingCfg, tracingErr := tracingConfig(cfg)
+			if err := errors.Join(cfg.Validate(), allocationErr, tracingErr); err != nil {
+				fatal(logger, "Invalid configuration", err)
+			}
 
-		configs := huma.DefaultConfig("Paye Ton Kawa - Products", "1.0.0")
-		api := humachi.New(router, configs)
+			shutdownTracing, err = tracing.Setup(context.Background(), tracingCfg)
+			if err != nil {
+				fatal(logger, "Failed to set up tracing", err)
+			}
 
-		operation.RegisterProductsRoutes(api, dbConn, ch)
+			dbConn = db.Init(cfg.Database)
+			if sqlDB, err := dbConn.DB(); err == nil {
+				if err := localMetrics.RegisterDBStats(sqlDB); err != nil {
+					logger.Error("Failed to register database metrics", slog.Any("error", err))
+				}
+			}
 
-		// Create the HTTP server.
-		server := &http.Server{
-			Addr:    fmt.Sprintf(":%d", options.Port),
-			Handler: router,
-		}
+			// Readiness checks, RabbitMQ is added below when enabled
+			checker := health.NewChecker(cfg.HTTP.ReadinessTimeout)
+			checker.Add("database", health.Database(dbConn))
+
+			// Event archive, pruned in the background with the processed
+			// message IDs, so the pruning runs even when it is disabled
+			var archive *rabbitmq.EventArchive
+			retention := rabbitmq.NewEventArchive(dbConn, cfg.Archive, logger)
+			go retention.RunRetention(background)
+			if cfg.Archive.Enabled {
+				archive = retention
+			}
 
-		// OnStart: blocking ListenAndServe
-		hooks.OnStart(func() {
-			log.Printf("Starting server on port %d...", options.Port)
+			// RabbitMQ setup
+			publisher = rabbitmq.NewPublisher(nil, cfg.RabbitMQ, logger)
+
+			if !cfg.RabbitMQ.Disabled {
+				conn, ch, err = rabbitmq.Connect(cfg.RabbitMQ)
+				if err != nil {
+					fatal(logger, "Failed to connect to RabbitMQ", err)
+				}
+				publisher = rabbitmq.NewPublisher(ch, cfg.RabbitMQ, logger)
+				if archive != nil {
+					publisher.UseArchive(archive)
+				}
+
+				eventRouter, err := rabbitmq.SetupEventHandlers(dbConn, publisher, archive, allocation, cfg.RabbitMQ, logger)
+				if err != nil {
+					fatal(logger, "Failed to set up event handlers", err)
+				}
+				checker.Add("rabbitmq", rabbitmq.HealthCheck(conn, ch, eventRouter))
+				if cfg.RabbitMQ.DeadLetterExchange == "" {
+					logger.Warn("No dead letter exchange configured, rejected messages will be dropped")
+				}
+				consumer, err = rabbitmq.StartListening(ch, eventRouter, cfg.RabbitMQ)
+				if err != nil {
+					fatal(logger, "Failed to start event listener", err)
+				}
+				if cfg.RabbitMQ.MaxBacklog > 0 {
+					checker.Add("backlog", rabbitmq.BacklogCheck(conn, consumer.Queue(), cfg.RabbitMQ.MaxBacklog))
+				}
+
+				// Once listening, so the snapshots are consumed
+				if cfg.RabbitMQ.SnapshotOnStart {
+					if err := rabbitmq.RequestSnapshots(context.Background(), dbConn, publisher); err != nil {
+						logger.Error("Failed to request snapshots", slog.Any("error", err))
+					}
+				}
+			} else {
+				logger.Info("RabbitMQ disabled, skipping RabbitMQ connection")
+			}
+
+			// Once the publisher is set up, for the stock alerts of the repairs
+			if cfg.Reconciliation.Enabled {
+				go newReconciler(cfg, dbConn, allocation, publisher, logger).Run(background, cfg.Reconciliation.Interval, cfg.Reconciliation.Repair)
+			}
+
+			// Media storage setup
+			store, err := media.NewLocalStorage(cfg.Media.Path)
+			if err != nil {
+				fatal(logger, "Failed to open media storage", err)
+			}
+
+			// Create a new router & API
+			router := chi.NewMux()
+
+			router.Use(logging.Middleware(logger))
+			router.Use(middleware.Recoverer)
+			router.Use(middleware.Compress(5))
+
+			router.Use(metrics.Collector(metrics.CollectorOpts{
+				Host:  false,
+				Proto: true,
+				Skip: func(r *http.Request) bool {
+					return r.Method != "OPTIONS"
+				},
+			}))
+
+			router.Handle("/metrics", metrics.Handler())
+
+			configs := huma.DefaultConfig("Paye Ton Kawa - Products", "1.0.0")
+			api := humachi.New(router, configs)
+			api.UseMiddleware(tracing.Middleware)
+			api.UseMiddleware(db.Middleware)
+
+			operation.RegisterHealthRoutes(api, checker)
+			operation.RegisterProductsRoutes(api, dbConn, publisher, store)
+			operation.RegisterImageRoutes(api, dbConn, store)
+			operation.RegisterRestockRoutes(api, dbConn, publisher)
+			operation.RegisterWarehouseRoutes(api, dbConn, publisher)
+			operation.RegisterArchiveRoutes(api, dbConn)
+
+			// Create the HTTP server.
+			server = &http.Server{
+				Addr:    fmt.Sprintf(":%d", cfg.HTTP.Port),
+				Handler: router,
+			}
+
+			logger.Info("Starting server", slog.Int("port", cfg.HTTP.Port))
 			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-				log.Fatalf("HTTP server failed: %v", err)
+				fatal(logger, "HTTP server failed", err)
 			}
 		})
 
-		// OnStop: graceful shutdown
+		// OnStop: graceful shutdown. Stop taking work, finish the work in
+		// flight, then close the dependencies in the reverse order of use.
 		hooks.OnStop(func() {
-			// Give the server 5 seconds to gracefully shut down, then give up.
-			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			// Give the server some time to gracefully shut down, then give up.
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.HTTP.ShutdownTimeout)
 			defer cancel()
-			if err := server.Shutdown(ctx); err != nil {
-				log.Printf("Server shutdown error: %v", err)
+			if server != nil {
+				if err := server.Shutdown(ctx); err != nil {
+					logger.Error("Server shutdown error", slog.Any("error", err))
+				}
 			}
-			if conn != nil {
-				_ = conn.Close()
+
+			// Let the event handlers finish, interrupting them past the drain timeout
+			drainCtx, cancelDrain := context.WithTimeout(context.Background(), cfg.RabbitMQ.DrainTimeout)
+			defer cancelDrain()
+			if consumer != nil {
+				if err := consumer.Stop(drainCtx); err != nil {
+					logger.Error("Event consumer shutdown error", slog.Any("error", err))
+				}
+			}
+			if publisher != nil {
+				if err := publisher.Close(drainCtx); err != nil {
+					logger.Error("Publisher shutdown error", slog.Any("error", err))
+				}
+			}
+
+			stopBackground()
+			if dbConn != nil {
+				if err := db.Close(dbConn); err != nil {
+					logger.Error("Database shutdown error", slog.Any("error", err))
+				}
 			}
 			if ch != nil {
 				_ = ch.Close()
 			}
+			if conn != nil {
+				_ = conn.Close()
+			}
+			if err := shutdownTracing(ctx); err != nil {
+				logger.Error("Tracing shutdown error", slog.Any("error", err))
+			}
 		})
 	})
 
+	cli.Root().AddCommand(newMigrateCommand(&cfg), newConfigCommand(&cfg), newReplayCommand(&cfg), newReconcileCommand(&cfg))
+
 	// Run the CLI. When passed no commands, it starts the server.
 	cli.Run()
 }
+
+// fatal logs an error and exits
+func fatal(logger *slog.Logger, msg string, err error) {
+	logger.Error(msg, slog.Any("error", err))
+	os.Exit(1)
+}
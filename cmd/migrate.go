@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/config"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/db"
+	"github.com/spf13/cobra"
+)
+
+// newMigrateCommand builds the `migrate up|down|status` command
+func newMigrateCommand(cfg *config.Config) *cobra.Command {
+	migrate := &cobra.Command{
+		Use:   "migrate",
+		Short: "Manage the database schema",
+	}
+
+	// openMigrator connects to the database for one migrate subcommand
+	openMigrator := func() (*db.Migrator, error) {
+		if err := cfg.Database.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid configuration:\n%w", err)
+		}
+		conn, err := db.Open(cfg.Database)
+		if err != nil {
+			return nil, fmt.Errorf("connect to database: %w", err)
+		}
+		return db.NewMigrator(conn)
+	}
+
+	migrate.AddCommand(&cobra.Command{
+		Use:   "up",
+		Short: "Apply every pending migration",
+		Args:  cobra.NoArgs,
+		Run: exitOnError(func(cmd *cobra.Command, args []string) error {
+			migrator, err := openMigrator()
+			if err != nil {
+				return err
+			}
+
+			applied, err := migrator.Up(cmd.Context())
+			for _, m := range applied {
+				slog.Info("Applied migration", slog.Uint64("version", uint64(m.Version)), slog.String("name", m.Name))
+			}
+			if err != nil {
+				return err
+			}
+			if len(applied) == 0 {
+				slog.Info("Schema is up to date")
+			}
+			return nil
+		}),
+	})
+
+	migrate.AddCommand(&cobra.Command{
+		Use:   "down [steps]",
+		Short: "Roll back the last applied migrations (1 by default)",
+		Args:  cobra.MaximumNArgs(1),
+		Run: exitOnError(func(cmd *cobra.Command, args []string) error {
+			steps := 1
+			if len(args) == 1 {
+				n, err := strconv.Atoi(args[0])
+				if err != nil || n < 1 {
+					return fmt.Errorf("steps must be a positive number, got %q", args[0])
+				}
+				steps = n
+			}
+
+			migrator, err := openMigrator()
+			if err != nil {
+				return err
+			}
+
+			reverted, err := migrator.Down(cmd.Context(), steps)
+			for _, m := range reverted {
+				slog.Info("Rolled back migration", slog.Uint64("version", uint64(m.Version)), slog.String("name", m.Name))
+			}
+			return err
+		}),
+	})
+
+	migrate.AddCommand(&cobra.Command{
+		Use:   "status",
+		Short: "List migrations and whether they are applied",
+		Args:  cobra.NoArgs,
+		Run: exitOnError(func(cmd *cobra.Command, args []string) error {
+			migrator, err := openMigrator()
+			if err != nil {
+				return err
+			}
+
+			status, err := migrator.Status(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+			for _, s := range status {
+				appliedAt := "pending"
+				if s.AppliedAt != nil {
+					appliedAt = s.AppliedAt.Format(time.RFC3339)
+				}
+				fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+			}
+			return w.Flush()
+		}),
+	})
+
+	return migrate
+}
+
+// exitOnError runs a command, exiting with a non-zero status when it fails
+func exitOnError(run func(cmd *cobra.Command, args []string) error) func(*cobra.Command, []string) {
+	return func(cmd *cobra.Command, args []string) {
+		if err := run(cmd, args); err != nil {
+			fatal(slog.Default(), "Command failed", err)
+		}
+	}
+}
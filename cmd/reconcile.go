@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/config"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/db"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/inventory"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/rabbitmq"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/reconcile"
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+)
+
+// newReconcileCommand builds the `reconcile` command comparing the local
+// customers and orders with their services once
+func newReconcileCommand(cfg *config.Config) *cobra.Command {
+	var repair bool
+
+	reconcileCmd := &cobra.Command{
+		Use:   "reconcile",
+		Short: "Compare customers and orders with their services, optionally repairing the differences",
+		Args:  cobra.NoArgs,
+		Run: exitOnError(func(cmd *cobra.Command, args []string) error {
+			// Repairs publish the stock alerts they raise
+			alerting := repair && !cfg.RabbitMQ.Disabled
+			allocation, allocationErr := allocationStrategy(*cfg)
+			errs := []error{cfg.Database.Validate(), cfg.Reconciliation.Validate(), allocationErr}
+			if alerting {
+				errs = append(errs, cfg.RabbitMQ.Validate())
+			}
+			if err := errors.Join(errs...); err != nil {
+				return fmt.Errorf("invalid configuration:\n%w", err)
+			}
+
+			conn, err := db.Open(cfg.Database)
+			if err != nil {
+				return fmt.Errorf("connect to database: %w", err)
+			}
+			defer db.Close(conn)
+
+			publisher := rabbitmq.NewPublisher(nil, cfg.RabbitMQ, slog.Default())
+			if alerting {
+				amqpConn, ch, err := rabbitmq.Connect(cfg.RabbitMQ)
+				if err != nil {
+					return err
+				}
+				defer amqpConn.Close()
+				defer ch.Close()
+				publisher = rabbitmq.NewPublisher(ch, cfg.RabbitMQ, slog.Default())
+			}
+
+			report, err := newReconciler(*cfg, conn, allocation, publisher, slog.Default()).Reconcile(cmd.Context(), repair)
+			if err != nil {
+				return err
+			}
+
+			enc := json.NewEncoder(cmd.OutOrStdout())
+			enc.SetIndent("", "  ")
+			return enc.Encode(report)
+		}),
+	}
+
+	reconcileCmd.Flags().BoolVar(&repair, "repair", false, "Fix the differences found, stock included")
+
+	return reconcileCmd
+}
+
+// newReconciler creates the reconciler of the configured services
+func newReconciler(cfg config.Config, conn *gorm.DB, allocation inventory.AllocationStrategy, publisher *rabbitmq.Publisher, logger *slog.Logger) *reconcile.Reconciler {
+	client := reconcile.NewClient(&http.Client{Timeout: cfg.Reconciliation.Timeout}, cfg.Reconciliation.CustomersURL, cfg.Reconciliation.OrdersURL)
+	return reconcile.New(conn, client, allocation, cfg.Reconciliation.MaxDeletions, publisher.PublishStockEvent, logger)
+}
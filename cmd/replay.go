@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/config"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/db"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/rabbitmq"
+	"github.com/spf13/cobra"
+)
+
+// newReplayCommand builds the `replay` command handing archived or queued
+// events to the event handlers again, to rebuild the local read models
+func newReplayCommand(cfg *config.Config) *cobra.Command {
+	var file, queue, from, to string
+	var dryRun bool
+
+	replay := &cobra.Command{
+		Use:   "replay",
+		Short: "Replay events from an NDJSON archive or a replay queue",
+		Args:  cobra.NoArgs,
+		Run: exitOnError(func(cmd *cobra.Command, args []string) error {
+			if (file == "") == (queue == "") {
+				return errors.New("exactly one of --file and --queue is required")
+			}
+
+			opts := rabbitmq.ReplayOptions{DryRun: dryRun}
+			var err error
+			if opts.From, err = parseTime(from); err != nil {
+				return fmt.Errorf("--from: %w", err)
+			}
+			if opts.To, err = parseTime(to); err != nil {
+				return fmt.Errorf("--to: %w", err)
+			}
+
+			allocation, allocationErr := allocationStrategy(*cfg)
+			errs := []error{cfg.Database.Validate(), allocationErr}
+			if queue != "" {
+				errs = append(errs, cfg.RabbitMQ.Validate())
+			}
+			if err := errors.Join(errs...); err != nil {
+				return fmt.Errorf("invalid configuration:\n%w", err)
+			}
+
+			conn, err := db.Open(cfg.Database)
+			if err != nil {
+				return fmt.Errorf("connect to database: %w", err)
+			}
+			defer db.Close(conn)
+
+			// Replayed events are not published again
+			publisher := rabbitmq.NewPublisher(nil, cfg.RabbitMQ, slog.Default())
+			router, err := rabbitmq.SetupEventHandlers(conn, publisher, nil, allocation, cfg.RabbitMQ, slog.Default())
+			if err != nil {
+				return err
+			}
+
+			var result rabbitmq.ReplayResult
+			if file != "" {
+				result, err = replayFile(cmd, router, file, opts)
+			} else {
+				amqpConn, ch, connErr := rabbitmq.Connect(cfg.RabbitMQ)
+				if connErr != nil {
+					return connErr
+				}
+				defer amqpConn.Close()
+				defer ch.Close()
+				result, err = router.ReplayQueue(cmd.Context(), ch, queue, opts)
+			}
+
+			enc := json.NewEncoder(cmd.OutOrStdout())
+			enc.SetIndent("", "  ")
+			if encErr := enc.Encode(result); encErr != nil {
+				return encErr
+			}
+			if err == nil && result.Failed > 0 {
+				err = fmt.Errorf("%d events failed", result.Failed)
+			}
+			return err
+		}),
+	}
+
+	flags := replay.Flags()
+	flags.StringVar(&file, "file", "", "NDJSON archive to replay, - for stdin")
+	flags.StringVar(&queue, "queue", "", "Queue to replay until empty")
+	flags.StringVar(&from, "from", "", "Only replay events published at or after this time (RFC 3339)")
+	flags.StringVar(&to, "to", "", "Only replay events published before this time (RFC 3339)")
+	flags.BoolVar(&dryRun, "dry-run", false, "Count the events to replay without handling them")
+
+	return replay
+}
+
+// replayFile replays an NDJSON archive, read from stdin for "-"
+func replayFile(cmd *cobra.Command, router *rabbitmq.EventRouter, path string, opts rabbitmq.ReplayOptions) (rabbitmq.ReplayResult, error) {
+	var archive io.Reader = cmd.InOrStdin()
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return rabbitmq.ReplayResult{}, err
+		}
+		defer f.Close()
+		archive = f
+	}
+	return router.ReplayArchive(cmd.Context(), archive, opts)
+}
+
+// parseTime parses an optional RFC 3339 time
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
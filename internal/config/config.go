@@ -0,0 +1,437 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the configuration of the service. Values come from the defaults,
+// then the optional YAML file, then the environment (env tags), then the
+// --port flag.
+type Config struct {
+	HTTP      HTTP      `yaml:"http"`
+	Database  Database  `yaml:"database"`
+	RabbitMQ  RabbitMQ  `yaml:"rabbitmq"`
+	Log       Log       `yaml:"log"`
+	Tracing   Tracing   `yaml:"tracing"`
+	Media     Media     `yaml:"media"`
+	Warehouse Warehouse `yaml:"warehouse"`
+	Archive   Archive   `yaml:"archive"`
+
+	Reconciliation Reconciliation `yaml:"reconciliation"`
+}
+
+type HTTP struct {
+	Port             int           `yaml:"port" env:"SERVICE_PORT"`
+	ShutdownTimeout  time.Duration `yaml:"shutdownTimeout" env:"HTTP_SHUTDOWN_TIMEOUT"`
+	ReadinessTimeout time.Duration `yaml:"readinessTimeout" env:"READINESS_TIMEOUT"`
+}
+
+type Database struct {
+	DSN             string        `yaml:"dsn" env:"DATABASE_DSN" secret:"true"`
+	ReplicaDSN      string        `yaml:"replicaDsn" env:"DATABASE_REPLICA_DSN" secret:"true"`
+	MaxOpenConns    int           `yaml:"maxOpenConns" env:"DB_MAX_OPEN_CONNS"`
+	MaxIdleConns    int           `yaml:"maxIdleConns" env:"DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime time.Duration `yaml:"connMaxLifetime" env:"DB_CONN_MAX_LIFETIME"`
+	ConnMaxIdleTime time.Duration `yaml:"connMaxIdleTime" env:"DB_CONN_MAX_IDLE_TIME"`
+	MigrateOnStart  bool          `yaml:"migrateOnStart" env:"MIGRATE_ON_START"`
+
+	// StatementTimeout cancels queries running longer, 0 disables it
+	StatementTimeout time.Duration `yaml:"statementTimeout" env:"DB_STATEMENT_TIMEOUT"`
+	// ConnectTimeout bounds the retries while the database is unreachable at startup
+	ConnectTimeout time.Duration `yaml:"connectTimeout" env:"DB_CONNECT_TIMEOUT"`
+	// ConnectBackoff is the first wait between retries, doubled up to ten times as long
+	ConnectBackoff time.Duration `yaml:"connectBackoff" env:"DB_CONNECT_BACKOFF"`
+}
+
+type RabbitMQ struct {
+	DSN      string `yaml:"dsn" env:"RABBIT_DSN" secret:"true"`
+	Disabled bool   `yaml:"disabled" env:"DISABLE_RABBITMQ"`
+	Exchange string `yaml:"exchange" env:"RABBIT_EXCHANGE"`
+	Queue    string `yaml:"queue" env:"RABBIT_QUEUE"`
+	// DeadLetterExchange receives the rejected messages, in a queue of the
+	// same name. Messages are dropped when rejected with it set empty.
+	DeadLetterExchange string `yaml:"deadLetterExchange" env:"RABBIT_DEAD_LETTER_EXCHANGE"`
+	Prefetch           int    `yaml:"prefetch" env:"RABBIT_PREFETCH"`
+	// Workers is the number of messages handled in parallel
+	Workers        int           `yaml:"workers" env:"RABBIT_WORKERS"`
+	PublishTimeout time.Duration `yaml:"publishTimeout" env:"RABBIT_PUBLISH_TIMEOUT"`
+	// CloudEvents publishes events as CloudEvents in "binary" or "structured"
+	// mode, or as plain JSON when empty. Both are consumed either way.
+	CloudEvents string `yaml:"cloudEvents" env:"RABBIT_CLOUDEVENTS"`
+	// CloudEventsSource is the source attribute of the published CloudEvents,
+	// also sent as origin header to recognize the events of this service
+	CloudEventsSource string `yaml:"cloudEventsSource" env:"RABBIT_CLOUDEVENTS_SOURCE"`
+	// HandlerTimeout bounds the handling of one message, 0 disables it
+	HandlerTimeout time.Duration `yaml:"handlerTimeout" env:"RABBIT_HANDLER_TIMEOUT"`
+	// MaxBacklog is the most messages waiting in the consumed queue before
+	// readiness fails, 0 disables the check
+	MaxBacklog int `yaml:"maxBacklog" env:"RABBIT_MAX_BACKLOG"`
+	// DrainTimeout bounds the wait for in-flight handlers on shutdown
+	DrainTimeout time.Duration `yaml:"drainTimeout" env:"RABBIT_DRAIN_TIMEOUT"`
+	// SnapshotBatchSize is the number of products per product.snapshot event
+	SnapshotBatchSize int `yaml:"snapshotBatchSize" env:"RABBIT_SNAPSHOT_BATCH_SIZE"`
+	// SnapshotOnStart requests the customer and order snapshots on startup
+	// when the local tables are empty
+	SnapshotOnStart bool `yaml:"snapshotOnStart" env:"RABBIT_SNAPSHOT_ON_START"`
+}
+
+type Log struct {
+	Level string `yaml:"level" env:"LOG_LEVEL"`
+}
+
+type Tracing struct {
+	ServiceName string `yaml:"serviceName" env:"OTEL_SERVICE_NAME"`
+	// Exporter is parsed by the tracing package
+	Exporter string `yaml:"exporter" env:"OTEL_TRACES_EXPORTER"`
+	File     string `yaml:"file" env:"OTEL_TRACES_FILE"`
+}
+
+type Media struct {
+	Path string `yaml:"path" env:"MEDIA_STORAGE_PATH"`
+}
+
+type Warehouse struct {
+	// Allocation is parsed by the inventory package
+	Allocation string `yaml:"allocation" env:"WAREHOUSE_ALLOCATION_STRATEGY"`
+}
+
+// Archive keeps the consumed and published messages for auditing
+type Archive struct {
+	Enabled bool `yaml:"enabled" env:"EVENT_ARCHIVE_ENABLED"`
+	// Retention deletes the archived messages older than it, 0 keeps them
+	Retention time.Duration `yaml:"retention" env:"EVENT_ARCHIVE_RETENTION"`
+	// FailureRetention applies instead to the messages that failed or were rejected
+	FailureRetention time.Duration `yaml:"failureRetention" env:"EVENT_ARCHIVE_FAILURE_RETENTION"`
+	// ProcessedRetention forgets the IDs of the handled messages older than
+	// it, archive enabled or not. Redeliveries arriving later are handled
+	// again, 0 keeps the IDs.
+	ProcessedRetention time.Duration `yaml:"processedRetention" env:"PROCESSED_MESSAGES_RETENTION"`
+	// PruneInterval is the time between two deletions of expired messages
+	PruneInterval time.Duration `yaml:"pruneInterval" env:"EVENT_ARCHIVE_PRUNE_INTERVAL"`
+}
+
+// Reconciliation compares the local customers and orders with the services
+// owning them
+type Reconciliation struct {
+	// Enabled runs the reconciliation every interval, the reconcile command
+	// runs it on demand either way
+	Enabled  bool          `yaml:"enabled" env:"RECONCILE_ENABLED"`
+	Interval time.Duration `yaml:"interval" env:"RECONCILE_INTERVAL"`
+	// Repair fixes the differences found, stock included, instead of only
+	// reporting them
+	Repair       bool          `yaml:"repair" env:"RECONCILE_REPAIR"`
+	CustomersURL string        `yaml:"customersUrl" env:"CUSTOMERS_API_URL"`
+	OrdersURL    string        `yaml:"ordersUrl" env:"ORDERS_API_URL"`
+	Timeout      time.Duration `yaml:"timeout" env:"RECONCILE_TIMEOUT"`
+	// MaxDeletions is the most customers and orders a repair may delete,
+	// larger repairs are refused as the services likely answered partially
+	MaxDeletions int `yaml:"maxDeletions" env:"RECONCILE_MAX_DELETIONS"`
+}
+
+// Default returns the configuration used when nothing overrides it
+func Default() Config {
+	return Config{
+		HTTP: HTTP{
+			Port:             8083,
+			ShutdownTimeout:  5 * time.Second,
+			ReadinessTimeout: 2 * time.Second,
+		},
+		Database: Database{
+			MaxOpenConns:    25,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+
+			StatementTimeout: 30 * time.Second,
+			ConnectTimeout:   time.Minute,
+			ConnectBackoff:   500 * time.Millisecond,
+		},
+		RabbitMQ: RabbitMQ{
+			Exchange:           "events",
+			DeadLetterExchange: "products.dead-letter",
+			Prefetch:           10,
+			Workers:            4,
+			PublishTimeout:     5 * time.Second,
+			HandlerTimeout:     30 * time.Second,
+			DrainTimeout:       15 * time.Second,
+			MaxBacklog:         10000,
+
+			CloudEventsSource: "/products",
+			SnapshotBatchSize: 100,
+			SnapshotOnStart:   true,
+		},
+		Log:       Log{Level: "info"},
+		Tracing:   Tracing{ServiceName: "products", Exporter: "none", File: "traces.json"},
+		Media:     Media{Path: "media"},
+		Warehouse: Warehouse{Allocation: "priority"},
+		Archive: Archive{
+			Retention:        30 * 24 * time.Hour,
+			FailureRetention: 90 * 24 * time.Hour,
+
+			ProcessedRetention: 7 * 24 * time.Hour,
+			PruneInterval:      time.Hour,
+		},
+		Reconciliation: Reconciliation{
+			Interval:     time.Hour,
+			Timeout:      30 * time.Second,
+			MaxDeletions: 100,
+		},
+	}
+}
+
+// Load builds the configuration from the defaults, the YAML file when path is
+// set, and the environment
+func Load(path string) (Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return cfg, fmt.Errorf("read config file: %w", err)
+		}
+		decoder := yaml.NewDecoder(bytes.NewReader(content))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&cfg); err != nil {
+			return cfg, fmt.Errorf("parse config file %s: %w", path, err)
+		}
+	}
+
+	if err := loadEnv(reflect.ValueOf(&cfg).Elem()); err != nil {
+		return cfg, err
+	}
+
+	return cfg, nil
+}
+
+// loadEnv overrides the fields tagged with env from the environment
+func loadEnv(v reflect.Value) error {
+	for i := 0; i < v.NumField(); i++ {
+		field, info := v.Field(i), v.Type().Field(i)
+
+		if field.Kind() == reflect.Struct {
+			if err := loadEnv(field); err != nil {
+				return err
+			}
+			continue
+		}
+
+		name := info.Tag.Get("env")
+		value, ok := os.LookupEnv(name)
+		if name == "" || !ok || value == "" {
+			continue
+		}
+
+		if err := setField(field, value); err != nil {
+			return fmt.Errorf("environment variable %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func setField(field reflect.Value, value string) error {
+	switch {
+	case field.Type() == durationType:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+	case field.Kind() == reflect.String:
+		field.SetString(value)
+	case field.Kind() == reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", value)
+		}
+		field.SetInt(int64(n))
+	case field.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", value)
+		}
+		field.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+	return nil
+}
+
+// Validate reports every invalid setting at once. Commands using only some
+// sections validate those instead.
+func (c Config) Validate() error {
+	errs := []error{c.HTTP.Validate(), c.Database.Validate(), c.RabbitMQ.Validate(), c.Log.Validate(), c.Media.Validate(), c.Archive.Validate()}
+	if c.Reconciliation.Enabled {
+		errs = append(errs, c.Reconciliation.Validate())
+		if c.Reconciliation.Interval <= 0 {
+			errs = append(errs, errors.New("reconciliation.interval: must be positive"))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checks collects the errors of the failed checks of a section
+type checks []error
+
+func (c *checks) check(ok bool, format string, args ...any) {
+	if !ok {
+		*c = append(*c, fmt.Errorf(format, args...))
+	}
+}
+
+// Validate reports the invalid settings of the HTTP server
+func (h HTTP) Validate() error {
+	var errs checks
+	errs.check(h.Port > 0 && h.Port <= 65535, "http.port: must be between 1 and 65535, got %d", h.Port)
+	errs.check(h.ShutdownTimeout > 0, "http.shutdownTimeout: must be positive")
+	errs.check(h.ReadinessTimeout > 0, "http.readinessTimeout: must be positive")
+	return errors.Join(errs...)
+}
+
+// Validate reports the invalid settings of the database connection
+func (d Database) Validate() error {
+	var errs checks
+	errs.check(d.DSN != "", "database.dsn: required (DATABASE_DSN)")
+	errs.check(d.MaxOpenConns >= 0, "database.maxOpenConns: must not be negative")
+	errs.check(d.MaxIdleConns >= 0, "database.maxIdleConns: must not be negative")
+	errs.check(d.MaxOpenConns == 0 || d.MaxIdleConns <= d.MaxOpenConns,
+		"database.maxIdleConns: must not exceed maxOpenConns (%d)", d.MaxOpenConns)
+	errs.check(d.ConnMaxLifetime >= 0, "database.connMaxLifetime: must not be negative")
+	errs.check(d.ConnMaxIdleTime >= 0, "database.connMaxIdleTime: must not be negative")
+	errs.check(d.StatementTimeout >= 0, "database.statementTimeout: must not be negative")
+	errs.check(d.ConnectTimeout >= 0, "database.connectTimeout: must not be negative")
+	errs.check(d.ConnectBackoff > 0, "database.connectBackoff: must be positive")
+	return errors.Join(errs...)
+}
+
+// Validate reports the invalid settings of RabbitMQ, none when disabled
+func (r RabbitMQ) Validate() error {
+	if r.Disabled {
+		return nil
+	}
+
+	var errs checks
+	errs.check(r.DSN != "", "rabbitmq.dsn: required unless rabbitmq.disabled is set (RABBIT_DSN)")
+	errs.check(r.Exchange != "", "rabbitmq.exchange: required")
+	errs.check(r.Prefetch >= 0, "rabbitmq.prefetch: must not be negative")
+	errs.check(r.Workers > 0, "rabbitmq.workers: must be positive")
+	errs.check(r.Prefetch == 0 || r.Prefetch >= r.Workers,
+		"rabbitmq.prefetch: must be at least workers (%d) to keep every worker busy", r.Workers)
+	errs.check(r.PublishTimeout > 0, "rabbitmq.publishTimeout: must be positive")
+	errs.check(r.HandlerTimeout >= 0, "rabbitmq.handlerTimeout: must not be negative")
+	errs.check(r.DrainTimeout > 0, "rabbitmq.drainTimeout: must be positive")
+	errs.check(r.MaxBacklog >= 0, "rabbitmq.maxBacklog: must not be negative")
+	errs.check(r.SnapshotBatchSize > 0, "rabbitmq.snapshotBatchSize: must be positive")
+	switch r.CloudEvents {
+	case "", "binary", "structured":
+		errs.check(r.CloudEvents == "" || r.CloudEventsSource != "", "rabbitmq.cloudEventsSource: required with CloudEvents")
+	default:
+		errs.check(false, "rabbitmq.cloudEvents: must be empty, binary or structured, got %q", r.CloudEvents)
+	}
+	return errors.Join(errs...)
+}
+
+// Validate reports an unknown log level
+func (l Log) Validate() error {
+	if !validLevel(l.Level) {
+		return fmt.Errorf("log.level: must be debug, info, warn or error, got %q", l.Level)
+	}
+	return nil
+}
+
+// Validate reports a missing media storage path
+func (m Media) Validate() error {
+	if m.Path == "" {
+		return errors.New("media.path: required")
+	}
+	return nil
+}
+
+// Validate reports the invalid settings of the event archive and of the
+// retention of processed messages, pruned either way
+func (a Archive) Validate() error {
+	var errs checks
+	if a.Enabled {
+		errs.check(a.Retention >= 0, "archive.retention: must not be negative")
+		errs.check(a.FailureRetention >= 0, "archive.failureRetention: must not be negative")
+	}
+	errs.check(a.ProcessedRetention >= 0, "archive.processedRetention: must not be negative")
+	errs.check(a.PruneInterval > 0, "archive.pruneInterval: must be positive")
+	return errors.Join(errs...)
+}
+
+// Validate reports the invalid settings needed to reach the services
+func (r Reconciliation) Validate() error {
+	var errs []error
+	for _, setting := range []struct{ name, value string }{
+		{"customersUrl", r.CustomersURL},
+		{"ordersUrl", r.OrdersURL},
+	} {
+		if u, err := url.Parse(setting.value); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("reconciliation.%s: must be an http(s) URL, got %q", setting.name, setting.value))
+		}
+	}
+	if r.Timeout <= 0 {
+		errs = append(errs, errors.New("reconciliation.timeout: must be positive"))
+	}
+	if r.MaxDeletions < 0 {
+		errs = append(errs, errors.New("reconciliation.maxDeletions: must not be negative"))
+	}
+	return errors.Join(errs...)
+}
+
+func validLevel(level string) bool {
+	switch strings.ToLower(level) {
+	case "debug", "info", "warn", "error":
+		return true
+	}
+	return false
+}
+
+// Redacted returns the configuration as YAML with secrets masked
+func (c Config) Redacted() (string, error) {
+	redact(reflect.ValueOf(&c).Elem())
+
+	out, err := yaml.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// redact masks the fields tagged as secret
+func redact(v reflect.Value) {
+	for i := 0; i < v.NumField(); i++ {
+		field, info := v.Field(i), v.Type().Field(i)
+
+		if field.Kind() == reflect.Struct {
+			redact(field)
+			continue
+		}
+		if info.Tag.Get("secret") == "true" && field.String() != "" {
+			field.SetString(RedactDSN(field.String()))
+		}
+	}
+}
+
+var dsnPassword = regexp.MustCompile(`(password=)\S+`)
+
+// RedactDSN masks the password of a URL or key=value connection string
+func RedactDSN(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" {
+		return u.Redacted()
+	}
+	return dsnPassword.ReplaceAllString(dsn, "${1}xxxxx")
+}
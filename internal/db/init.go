@@ -1,26 +1,165 @@
 package db
 
 import (
-	"log"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
 	"os"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 
-	"github.com/PayeTonKawa-EPSI-2025/Common-V2/models"
-
-	localModels "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/models"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/config"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/tracing"
 )
 
-func Init() *gorm.DB {
-	dsn := os.Getenv("DATABASE_DSN")
+// Open connects to the database, and to the read replica when configured,
+// without checking the schema
+func Open(cfg config.Database) (*gorm.DB, error) {
+	primary, err := openPool(cfg.DSN, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: primary}), &gorm.Config{})
+	if err != nil {
+		primary.Close()
+		return nil, err
+	}
+
+	if cfg.ReplicaDSN != "" {
+		replica, err := openPool(cfg.ReplicaDSN, cfg)
+		if err != nil {
+			primary.Close()
+			return nil, fmt.Errorf("replica: %w", err)
+		}
+		if err := replica.Ping(); err != nil {
+			primary.Close()
+			replica.Close()
+			return nil, fmt.Errorf("replica: %w", err)
+		}
+		if err := db.Use(ReplicaPlugin{Replica: replica}); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := db.Use(tracing.GormPlugin{}); err != nil {
+		slog.Error("Failed to register GORM tracing", slog.Any("error", err))
+	}
+
+	return db, nil
+}
+
+// openPool opens a connection pool with the pool settings and statement
+// timeout of the configuration
+func openPool(dsn string, cfg config.Database) (*sql.DB, error) {
+	connConfig, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.StatementTimeout > 0 {
+		connConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(cfg.StatementTimeout.Milliseconds(), 10)
+	}
+
+	sqlDB := stdlib.OpenDB(*connConfig)
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+	return sqlDB, nil
+}
+
+// Connect opens the database, retrying with an exponential backoff until
+// cfg.ConnectTimeout has elapsed, so the service can start before Postgres
+func Connect(ctx context.Context, cfg config.Database) (*gorm.DB, error) {
+	ctx, cancel := context.WithTimeout(ctx, cfg.ConnectTimeout)
+	defer cancel()
+
+	backoff := cfg.ConnectBackoff
+	for attempt := 1; ; attempt++ {
+		db, err := Open(cfg)
+		if err == nil {
+			return db, nil
+		}
 
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+		slog.Warn("Database unavailable, retrying",
+			slog.Int("attempt", attempt),
+			slog.String("retry_in", backoff.String()),
+			slog.Any("error", err),
+		)
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("gave up after %d attempts: %w", attempt, err)
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, cfg.ConnectBackoff*10)
+	}
+}
+
+// Init connects to the database and checks its schema is current. Pending
+// migrations are applied when migrateOnStart is set; otherwise the service
+// refuses to start until `migrate up` has been run.
+func Init(cfg config.Database) *gorm.DB {
+	db, err := Connect(context.Background(), cfg)
 	if err != nil {
-		log.Fatal("failed to connect to database:", err)
+		slog.Error("Failed to connect to database", slog.Any("error", err))
+		os.Exit(1)
 	}
 
-	db.AutoMigrate(&models.Product{}, &localModels.Customer{}, &localModels.Order{}, &localModels.OrderProduct{})
+	if err := checkSchema(context.Background(), db, cfg.MigrateOnStart); err != nil {
+		slog.Error("Database schema is not current", slog.Any("error", err))
+		os.Exit(1)
+	}
 
 	return db
 }
+
+// Close closes the connection pools of the primary and of the replica
+func Close(db *gorm.DB) error {
+	var errs []error
+	if plugin, ok := db.Config.Plugins[ReplicaPlugin{}.Name()].(ReplicaPlugin); ok {
+		errs = append(errs, plugin.Replica.Close())
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	errs = append(errs, sqlDB.Close())
+	return errors.Join(errs...)
+}
+
+// checkSchema fails when migrations are pending, applying them first if asked
+func checkSchema(ctx context.Context, db *gorm.DB, migrate bool) error {
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	if migrate {
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		for _, m := range applied {
+			slog.Info("Applied migration", slog.Uint64("version", uint64(m.Version)), slog.String("name", m.Name))
+		}
+	}
+
+	pending, err := migrator.Pending(ctx)
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%d pending migrations, starting with %d_%s: run `migrate up`", len(pending), pending[0].Version, pending[0].Name)
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+package db_test
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/db"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func setupMockDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	dbMock, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: dbMock,
+	}), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open gorm DB: %v", err)
+	}
+
+	return gormDB, mock
+}
+
+func expectApplied(mock sqlmock.Sqlmock, versions ...uint) {
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE TABLE IF NOT EXISTS "schema_migrations"`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	rows := sqlmock.NewRows([]string{"version", "name", "applied_at"})
+	for _, v := range versions {
+		rows.AddRow(v, "migration", time.Now())
+	}
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "schema_migrations" ORDER BY version`)).
+		WillReturnRows(rows)
+}
+
+func TestMigratorPending(t *testing.T) {
+	gormDB, mock := setupMockDB(t)
+	expectApplied(mock, 1)
+
+	migrator, err := db.NewMigrator(gormDB)
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+
+	pending, err := migrator.Pending(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(pending) == 0 || pending[0].Version != 2 {
+		t.Fatalf("expected migrations from version 2 to be pending, got %+v", pending)
+	}
+	for _, m := range pending {
+		if m.Up == "" {
+			t.Errorf("migration %d has no up script", m.Version)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestMigratorUpSkipsAppliedMigrations(t *testing.T) {
+	gormDB, mock := setupMockDB(t)
+
+	migrator, err := db.NewMigrator(gormDB)
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+
+	expectApplied(mock)
+	status, err := migrator.Status(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// Another replica applied every migration while this one waited for the lock
+	all := make([]uint, len(status))
+	for i, s := range status {
+		all[i] = s.Version
+	}
+	for range status {
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(`SELECT pg_advisory_xact_lock($1)`)).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta(`SET LOCAL statement_timeout = 0`)).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		expectApplied(mock, all...)
+		mock.ExpectCommit()
+	}
+
+	applied, err := migrator.Up(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(applied) != 0 {
+		t.Errorf("expected nothing to be applied, got %+v", applied)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
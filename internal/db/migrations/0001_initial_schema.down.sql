@@ -0,0 +1,12 @@
+DROP TABLE IF EXISTS "product_images";
+DROP TABLE IF EXISTS "restock_lines";
+DROP TABLE IF EXISTS "restocks";
+DROP TABLE IF EXISTS "suppliers";
+DROP TABLE IF EXISTS "stock_movements";
+DROP TABLE IF EXISTS "stock_transfers";
+DROP TABLE IF EXISTS "warehouse_stocks";
+DROP TABLE IF EXISTS "order_products";
+DROP TABLE IF EXISTS "warehouses";
+DROP TABLE IF EXISTS "orders";
+DROP TABLE IF EXISTS "customers";
+DROP TABLE IF EXISTS "products";
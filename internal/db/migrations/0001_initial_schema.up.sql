@@ -0,0 +1,159 @@
+-- Schema previously created by GORM AutoMigrate. Every statement is guarded so
+-- databases created before versioned migrations are adopted as they are, and
+-- the columns added since the first release are added to their tables.
+
+CREATE TABLE IF NOT EXISTS "products" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    "name" text,
+    "stock" bigint,
+    "details_price" decimal,
+    "details_description" text,
+    "details_color" text,
+    "status" text DEFAULT 'active',
+    "reorder_threshold" bigint DEFAULT 0,
+    PRIMARY KEY ("id")
+);
+ALTER TABLE "products" ADD COLUMN IF NOT EXISTS "status" text DEFAULT 'active';
+ALTER TABLE "products" ADD COLUMN IF NOT EXISTS "reorder_threshold" bigint DEFAULT 0;
+CREATE INDEX IF NOT EXISTS "idx_products_status" ON "products" ("status");
+CREATE INDEX IF NOT EXISTS "idx_products_deleted_at" ON "products" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "customers" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_customers_deleted_at" ON "customers" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "orders" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_orders_deleted_at" ON "orders" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "order_products" (
+    "id" bigserial,
+    "order_id" bigint,
+    "product_id" bigint,
+    "warehouse_id" bigint,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_order_products_order" FOREIGN KEY ("order_id") REFERENCES "orders"("id"),
+    CONSTRAINT "fk_order_products_product" FOREIGN KEY ("product_id") REFERENCES "products"("id")
+);
+ALTER TABLE "order_products" ADD COLUMN IF NOT EXISTS "warehouse_id" bigint;
+
+CREATE TABLE IF NOT EXISTS "warehouses" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    "code" text,
+    "name" text,
+    "priority" bigint DEFAULT 0,
+    "is_default" boolean DEFAULT false,
+    PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_warehouses_code" ON "warehouses" ("code");
+CREATE INDEX IF NOT EXISTS "idx_warehouses_deleted_at" ON "warehouses" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "warehouse_stocks" (
+    "id" bigserial,
+    "warehouse_id" bigint,
+    "product_id" bigint,
+    "quantity" bigint,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_products_warehouse_stocks" FOREIGN KEY ("product_id") REFERENCES "products"("id"),
+    CONSTRAINT "fk_warehouse_stocks_warehouse" FOREIGN KEY ("warehouse_id") REFERENCES "warehouses"("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_warehouse_product" ON "warehouse_stocks" ("warehouse_id", "product_id");
+
+CREATE TABLE IF NOT EXISTS "stock_transfers" (
+    "id" bigserial,
+    "product_id" bigint,
+    "from_warehouse_id" bigint,
+    "to_warehouse_id" bigint,
+    "quantity" bigint,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_stock_transfers_from_warehouse" FOREIGN KEY ("from_warehouse_id") REFERENCES "warehouses"("id"),
+    CONSTRAINT "fk_stock_transfers_to_warehouse" FOREIGN KEY ("to_warehouse_id") REFERENCES "warehouses"("id"),
+    CONSTRAINT "fk_stock_transfers_product" FOREIGN KEY ("product_id") REFERENCES "products"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_stock_transfers_product_id" ON "stock_transfers" ("product_id");
+
+CREATE TABLE IF NOT EXISTS "stock_movements" (
+    "id" bigserial,
+    "product_id" bigint,
+    "warehouse_id" bigint,
+    "delta" bigint,
+    "reason" text,
+    "reference" text,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_stock_movements_product" FOREIGN KEY ("product_id") REFERENCES "products"("id"),
+    CONSTRAINT "fk_stock_movements_warehouse" FOREIGN KEY ("warehouse_id") REFERENCES "warehouses"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_stock_movements_warehouse_id" ON "stock_movements" ("warehouse_id");
+CREATE INDEX IF NOT EXISTS "idx_stock_movements_product_id" ON "stock_movements" ("product_id");
+
+CREATE TABLE IF NOT EXISTS "suppliers" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    "name" text,
+    "email" text,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_suppliers_deleted_at" ON "suppliers" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "restocks" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    "supplier_id" bigint,
+    "warehouse_id" bigint,
+    "status" text DEFAULT 'pending',
+    "expected_at" timestamptz,
+    "received_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_restocks_supplier" FOREIGN KEY ("supplier_id") REFERENCES "suppliers"("id"),
+    CONSTRAINT "fk_restocks_warehouse" FOREIGN KEY ("warehouse_id") REFERENCES "warehouses"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_restocks_status" ON "restocks" ("status");
+CREATE INDEX IF NOT EXISTS "idx_restocks_deleted_at" ON "restocks" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "restock_lines" (
+    "id" bigserial,
+    "restock_id" bigint,
+    "product_id" bigint,
+    "quantity" bigint,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_restock_lines_product" FOREIGN KEY ("product_id") REFERENCES "products"("id"),
+    CONSTRAINT "fk_restocks_lines" FOREIGN KEY ("restock_id") REFERENCES "restocks"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_restock_lines_restock_id" ON "restock_lines" ("restock_id");
+
+CREATE TABLE IF NOT EXISTS "product_images" (
+    "id" bigserial,
+    "product_id" bigint,
+    "position" bigint,
+    "filename" text,
+    "content_type" text,
+    "size" bigint,
+    "storage_key" text,
+    "thumbnail_key" text,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_products_images" FOREIGN KEY ("product_id") REFERENCES "products"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_product_images_product_id" ON "product_images" ("product_id");
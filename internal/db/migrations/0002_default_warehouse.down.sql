@@ -0,0 +1 @@
+-- The default warehouse is kept: by now it holds stock and ledger entries.
@@ -0,0 +1,13 @@
+-- Create the default warehouse on a fresh database and move the stock of
+-- existing products into it. Databases that already have warehouses keep
+-- their stock as it is.
+
+INSERT INTO "warehouses" ("created_at", "updated_at", "code", "name", "priority", "is_default")
+SELECT now(), now(), 'main', 'Main warehouse', 0, true
+WHERE NOT EXISTS (SELECT 1 FROM "warehouses");
+
+INSERT INTO "warehouse_stocks" ("warehouse_id", "product_id", "quantity")
+SELECT w."id", p."id", p."stock"
+FROM "products" p, "warehouses" w
+WHERE w."code" = 'main' AND p."stock" > 0
+AND NOT EXISTS (SELECT 1 FROM "warehouse_stocks");
@@ -0,0 +1,9 @@
+-- Messages already handled, so redelivered ones are skipped
+
+CREATE TABLE IF NOT EXISTS "processed_messages" (
+    "message_id" text,
+    "routing_key" text NOT NULL,
+    "processed_at" timestamptz NOT NULL,
+    PRIMARY KEY ("message_id")
+);
+CREATE INDEX IF NOT EXISTS "idx_processed_messages_processed_at" ON "processed_messages" ("processed_at");
@@ -0,0 +1,21 @@
+-- Consumed and published messages, kept for auditing and replays
+
+CREATE TABLE IF NOT EXISTS "archived_events" (
+    "id" bigserial,
+    "direction" text NOT NULL,
+    "routing_key" text NOT NULL,
+    "entity_id" text,
+    "message_id" text,
+    "correlation_id" text,
+    "headers" jsonb,
+    "body" jsonb,
+    "outcome" text NOT NULL,
+    "error" text,
+    "duration_ms" bigint,
+    "timestamp" timestamptz,
+    "recorded_at" timestamptz NOT NULL,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_archived_events_routing_key" ON "archived_events" ("routing_key");
+CREATE INDEX IF NOT EXISTS "idx_archived_events_entity_id" ON "archived_events" ("entity_id");
+CREATE INDEX IF NOT EXISTS "idx_archived_events_recorded_at" ON "archived_events" ("recorded_at");
@@ -0,0 +1,14 @@
+DROP INDEX IF EXISTS "idx_order_products_product_id";
+
+DROP INDEX IF EXISTS "idx_orders_customer_id";
+ALTER TABLE "orders" DROP COLUMN IF EXISTS "synced_at";
+ALTER TABLE "orders" DROP COLUMN IF EXISTS "placed_at";
+ALTER TABLE "orders" DROP COLUMN IF EXISTS "status";
+ALTER TABLE "orders" DROP COLUMN IF EXISTS "customer_id";
+
+ALTER TABLE "customers" DROP COLUMN IF EXISTS "synced_at";
+ALTER TABLE "customers" DROP COLUMN IF EXISTS "company_name";
+ALTER TABLE "customers" DROP COLUMN IF EXISTS "name";
+ALTER TABLE "customers" DROP COLUMN IF EXISTS "last_name";
+ALTER TABLE "customers" DROP COLUMN IF EXISTS "first_name";
+ALTER TABLE "customers" DROP COLUMN IF EXISTS "username";
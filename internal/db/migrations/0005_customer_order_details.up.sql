@@ -0,0 +1,17 @@
+-- Customer and order fields carried by their events, so the mirrors can
+-- answer which customers bought a product
+
+ALTER TABLE "customers" ADD COLUMN IF NOT EXISTS "username" text;
+ALTER TABLE "customers" ADD COLUMN IF NOT EXISTS "first_name" text;
+ALTER TABLE "customers" ADD COLUMN IF NOT EXISTS "last_name" text;
+ALTER TABLE "customers" ADD COLUMN IF NOT EXISTS "name" text;
+ALTER TABLE "customers" ADD COLUMN IF NOT EXISTS "company_name" text;
+ALTER TABLE "customers" ADD COLUMN IF NOT EXISTS "synced_at" timestamptz;
+
+ALTER TABLE "orders" ADD COLUMN IF NOT EXISTS "customer_id" bigint;
+ALTER TABLE "orders" ADD COLUMN IF NOT EXISTS "status" text DEFAULT 'placed';
+ALTER TABLE "orders" ADD COLUMN IF NOT EXISTS "placed_at" timestamptz;
+ALTER TABLE "orders" ADD COLUMN IF NOT EXISTS "synced_at" timestamptz;
+CREATE INDEX IF NOT EXISTS "idx_orders_customer_id" ON "orders" ("customer_id");
+
+CREATE INDEX IF NOT EXISTS "idx_order_products_product_id" ON "order_products" ("product_id");
@@ -0,0 +1,64 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/danielgtaylor/huma/v2"
+	"gorm.io/gorm"
+)
+
+type replicaKey struct{}
+
+// WithReplica marks the context as safe to read from the replica, which may
+// lag slightly behind the primary
+func WithReplica(ctx context.Context) context.Context {
+	return context.WithValue(ctx, replicaKey{}, true)
+}
+
+func usesReplica(ctx context.Context) bool {
+	ok, _ := ctx.Value(replicaKey{}).(bool)
+	return ok
+}
+
+// Middleware sends the queries of GET operations to the read replica
+func Middleware(ctx huma.Context, next func(huma.Context)) {
+	if ctx.Method() == "GET" {
+		ctx = huma.WithContext(ctx, WithReplica(ctx.Context()))
+	}
+	next(ctx)
+}
+
+// ReplicaPlugin routes reads to the replica when the statement context was
+// marked with WithReplica. Writes and transactions always use the primary.
+type ReplicaPlugin struct {
+	Replica *sql.DB
+}
+
+// Name implements gorm.Plugin
+func (ReplicaPlugin) Name() string {
+	return "replica"
+}
+
+// Initialize registers the callbacks that switch the connection of reads
+func (p ReplicaPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	if err := cb.Query().Before("gorm:query").Register("replica:query", p.route); err != nil {
+		return err
+	}
+	if err := cb.Row().Before("gorm:row").Register("replica:row", p.route); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (p ReplicaPlugin) route(db *gorm.DB) {
+	if db.Statement.Context == nil || !usesReplica(db.Statement.Context) {
+		return
+	}
+	// A transaction must keep reading its own writes
+	if _, inTx := db.Statement.ConnPool.(gorm.TxCommitter); inTx {
+		return
+	}
+	db.Statement.ConnPool = p.Replica
+}
@@ -0,0 +1,69 @@
+package db_test
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/db"
+	"gorm.io/gorm"
+)
+
+type item struct {
+	ID   uint
+	Name string
+}
+
+func TestReplicaPluginRoutesMarkedReads(t *testing.T) {
+	gormDB, primary := setupMockDB(t)
+
+	replicaDB, replica, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	if err := gormDB.Use(db.ReplicaPlugin{Replica: replicaDB}); err != nil {
+		t.Fatalf("failed to register plugin: %v", err)
+	}
+
+	query := regexp.QuoteMeta(`SELECT * FROM "items"`)
+	replica.ExpectQuery(query).WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "replica"))
+	primary.ExpectQuery(query).WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "primary"))
+	primary.ExpectBegin()
+	primary.ExpectQuery(query).WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "primary"))
+	primary.ExpectCommit()
+
+	ctx := db.WithReplica(context.Background())
+
+	var items []item
+	if err := gormDB.WithContext(ctx).Find(&items).Error; err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(items) != 1 || items[0].Name != "replica" {
+		t.Errorf("expected marked read to hit the replica, got %+v", items)
+	}
+
+	if err := gormDB.WithContext(context.Background()).Find(&items).Error; err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if items[0].Name != "primary" {
+		t.Errorf("expected unmarked read to hit the primary, got %+v", items)
+	}
+
+	err = gormDB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return tx.Find(&items).Error
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if items[0].Name != "primary" {
+		t.Errorf("expected read in a transaction to hit the primary, got %+v", items)
+	}
+
+	if err := primary.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet primary expectations: %v", err)
+	}
+	if err := replica.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet replica expectations: %v", err)
+	}
+}
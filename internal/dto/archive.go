@@ -0,0 +1,31 @@
+package dto
+
+import (
+	"time"
+
+	localModels "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/models"
+)
+
+type ArchivedEventsFilter struct {
+	Type      string    `query:"type" doc:"Only return messages with this routing key, e.g. order.created"`
+	EntityID  string    `query:"entityId" doc:"Only return messages about this customer, order or product ID"`
+	Direction string    `query:"direction" enum:"consumed,published,all" default:"all" doc:"Only return consumed or published messages, or all of them"`
+	Outcome   string    `query:"outcome" enum:"handled,failed,rejected,published,all" default:"all" doc:"Only return messages with this outcome, or all of them"`
+	From      time.Time `query:"from" doc:"Only return messages archived at or after this time"`
+	To        time.Time `query:"to" doc:"Only return messages archived before this time"`
+}
+
+type ArchivedEventsInput struct {
+	ArchivedEventsFilter
+	Limit int `query:"limit" minimum:"1" maximum:"1000" default:"100" doc:"Maximum number of messages, newest first"`
+}
+
+type ArchivedEventsOutput struct {
+	Body struct {
+		Events []localModels.ArchivedEvent `json:"events"`
+	}
+}
+
+type ArchivedEventsExportInput struct {
+	ArchivedEventsFilter
+}
@@ -0,0 +1,17 @@
+package dto
+
+import "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/health"
+
+type LivenessOutput struct {
+	Body struct {
+		Status string `json:"status" enum:"up"`
+	}
+}
+
+type ReadinessOutput struct {
+	Status int
+	Body   struct {
+		Status string                   `json:"status" enum:"up,down"`
+		Checks map[string]health.Result `json:"checks"`
+	}
+}
@@ -0,0 +1,41 @@
+package dto
+
+import (
+	localModels "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/models"
+	"github.com/danielgtaylor/huma/v2"
+)
+
+type ProductImagesOutput struct {
+	Body struct {
+		Images []localModels.ProductImage `json:"images"`
+	}
+}
+
+type ProductImageOutput struct {
+	Body localModels.ProductImage
+}
+
+type ProductImageUploadInput struct {
+	ProductID uint `path:"id"`
+	RawBody   huma.MultipartFormFiles[struct {
+		File huma.FormFile `form:"file" contentType:"image/jpeg,image/png,image/gif" required:"true"`
+	}]
+}
+
+type ProductImageInput struct {
+	ProductID uint `path:"id"`
+	ImageID   uint `path:"imageId"`
+}
+
+type ProductImagesOrderInput struct {
+	ProductID uint `path:"id"`
+	Body      struct {
+		ImageIDs []uint `json:"imageIds" doc:"Every image of the product, in the new display order"`
+	}
+}
+
+type ImageContentOutput struct {
+	ContentType  string `header:"Content-Type"`
+	CacheControl string `header:"Cache-Control"`
+	Body         []byte
+}
@@ -1,25 +1,50 @@
 package dto
 
-import "github.com/PayeTonKawa-EPSI-2025/Common-V2/models"
+import (
+	"time"
+
+	"github.com/PayeTonKawa-EPSI-2025/Common-V2/models"
+	localModels "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/models"
+)
+
+type ProductsInput struct {
+	Status string `query:"status" enum:"draft,active,discontinued,all" default:"active" doc:"Only return products in this status, or all of them"`
+}
 
 type ProductsOutput struct {
 	Body struct {
-		Products []models.Product `json:"products"`
+		Products []localModels.Product `json:"products"`
 	}
 }
 
 type ProductOutput struct {
-	Body models.Product
+	Body localModels.Product
 }
 
 type ProductCreateInput struct {
 	Body struct {
-		Name    string                `json:"name"`
-		Stock   uint                  `json:"stock"`
-		Details models.ProductDetails `json:"details,omitempty"`
+		Name             string                    `json:"name"`
+		Stock            uint                      `json:"stock"`
+		Details          models.ProductDetails     `json:"details,omitempty"`
+		Status           localModels.ProductStatus `json:"status,omitempty" enum:"draft,active,discontinued" doc:"Defaults to active on creation"`
+		ReorderThreshold *uint                     `json:"reorderThreshold,omitempty" doc:"Stock level at or below which a low-stock alert is raised"`
 	}
 }
 
 type OrderProductsInput struct {
 	OrderID uint `json:"orderId" path:"orderId"`
 }
+
+// ProductCustomer is a customer who bought a product
+type ProductCustomer struct {
+	localModels.Customer
+	Orders        int        `json:"orders" doc:"Number of orders of the product"`
+	Units         int        `json:"units" doc:"Number of units bought"`
+	LastOrderedAt *time.Time `json:"lastOrderedAt,omitempty"`
+}
+
+type ProductCustomersOutput struct {
+	Body struct {
+		Customers []ProductCustomer `json:"customers"`
+	}
+}
@@ -0,0 +1,64 @@
+package dto
+
+import (
+	"time"
+
+	localModels "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/models"
+)
+
+type SuppliersOutput struct {
+	Body struct {
+		Suppliers []localModels.Supplier `json:"suppliers"`
+	}
+}
+
+type SupplierOutput struct {
+	Body localModels.Supplier
+}
+
+type SupplierCreateInput struct {
+	Body struct {
+		Name  string `json:"name" minLength:"1"`
+		Email string `json:"email,omitempty" format:"email"`
+	}
+}
+
+type RestocksInput struct {
+	Status string `query:"status" enum:"pending,received,cancelled,all" default:"pending" doc:"Only return restocks in this status, or all of them"`
+}
+
+type RestocksOutput struct {
+	Body struct {
+		Restocks []localModels.Restock `json:"restocks"`
+	}
+}
+
+type RestockOutput struct {
+	Body localModels.Restock
+}
+
+type RestockLineInput struct {
+	ProductID uint `json:"productId"`
+	Quantity  uint `json:"quantity" minimum:"1"`
+}
+
+type RestockCreateInput struct {
+	Body struct {
+		SupplierID  uint               `json:"supplierId"`
+		WarehouseID uint               `json:"warehouseId,omitempty" doc:"Receiving warehouse, defaults to the default warehouse"`
+		ExpectedAt  *time.Time         `json:"expectedAt,omitempty"`
+		Lines       []RestockLineInput `json:"lines" minItems:"1"`
+	}
+}
+
+type InboundQuantity struct {
+	ProductID      uint       `json:"productId"`
+	Quantity       uint       `json:"quantity"`
+	NextExpectedAt *time.Time `json:"nextExpectedAt,omitempty"`
+}
+
+type InboundOutput struct {
+	Body struct {
+		Inbound []InboundQuantity `json:"inbound"`
+	}
+}
@@ -0,0 +1,58 @@
+package dto
+
+import localModels "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/models"
+
+type WarehousesOutput struct {
+	Body struct {
+		Warehouses []localModels.Warehouse `json:"warehouses"`
+	}
+}
+
+type WarehouseOutput struct {
+	Body localModels.Warehouse
+}
+
+type WarehouseCreateInput struct {
+	Body struct {
+		Code     string `json:"code" minLength:"1"`
+		Name     string `json:"name" minLength:"1"`
+		Priority int    `json:"priority,omitempty" doc:"Allocation order, lowest first"`
+	}
+}
+
+type WarehouseStocksOutput struct {
+	Body struct {
+		Stocks []localModels.WarehouseStock `json:"stocks"`
+	}
+}
+
+type WarehouseStockOutput struct {
+	Body localModels.WarehouseStock
+}
+
+type WarehouseStockInput struct {
+	WarehouseID uint `path:"id"`
+	ProductID   uint `path:"productId"`
+	Body        struct {
+		Quantity uint `json:"quantity"`
+	}
+}
+
+type StockTransfersOutput struct {
+	Body struct {
+		Transfers []localModels.StockTransfer `json:"transfers"`
+	}
+}
+
+type StockTransferOutput struct {
+	Body localModels.StockTransfer
+}
+
+type StockTransferInput struct {
+	Body struct {
+		ProductID       uint `json:"productId"`
+		FromWarehouseID uint `json:"fromWarehouseId"`
+		ToWarehouseID   uint `json:"toWarehouseId"`
+		Quantity        uint `json:"quantity" minimum:"1"`
+	}
+}
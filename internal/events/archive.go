@@ -0,0 +1,54 @@
+package events
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// ArchivedMessage is a message as written to NDJSON archives, one per line
+type ArchivedMessage struct {
+	RoutingKey    string          `json:"routingKey"`
+	MessageID     string          `json:"messageId,omitempty"`
+	CorrelationID string          `json:"correlationId,omitempty"`
+	Timestamp     time.Time       `json:"timestamp"`
+	Headers       map[string]any  `json:"headers,omitempty"`
+	Body          json.RawMessage `json:"body"`
+}
+
+// Delivery returns the message as handed to handlers
+func (m ArchivedMessage) Delivery() Delivery {
+	return Delivery{
+		RoutingKey:    m.RoutingKey,
+		MessageID:     m.MessageID,
+		CorrelationID: m.CorrelationID,
+		Timestamp:     m.Timestamp,
+		Redelivered:   true,
+		Headers:       m.Headers,
+		Body:          m.Body,
+	}
+}
+
+// EntityID returns the ID of the entity an event is about, read from the body
+// field named by the first word of the routing key ("order" for
+// order.created), or "" when there is none
+func EntityID(routingKey string, body []byte) string {
+	entity, _, _ := strings.Cut(routingKey, ".")
+
+	var event map[string]json.RawMessage
+	if err := json.Unmarshal(body, &event); err != nil {
+		return ""
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(event[entity], &fields); err != nil {
+		return ""
+	}
+
+	// Order events carry orderId, the shared models a gorm.Model ID
+	for _, key := range []string{entity + "Id", "ID", "id"} {
+		if id, ok := fields[key]; ok {
+			return strings.Trim(string(id), `"`)
+		}
+	}
+	return ""
+}
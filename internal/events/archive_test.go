@@ -0,0 +1,27 @@
+package events_test
+
+import (
+	"testing"
+
+	localEvents "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/events"
+)
+
+func TestEntityID(t *testing.T) {
+	tests := []struct {
+		routingKey string
+		body       string
+		want       string
+	}{
+		{"order.created", `{"type":"order.created","order":{"orderId":42,"customerId":7}}`, "42"},
+		{"customer.updated", `{"type":"customer.updated","customer":{"ID":7}}`, "7"},
+		{"product.stock_low", `{"type":"product.stock_low","product":{"ID":3,"name":"Kawa"}}`, "3"},
+		{"invoice.paid", `{"type":"invoice.paid","invoice":{"number":"A-1"}}`, ""},
+		{"order.created", `not json`, ""},
+	}
+
+	for _, tt := range tests {
+		if got := localEvents.EntityID(tt.routingKey, []byte(tt.body)); got != tt.want {
+			t.Errorf("EntityID(%s, %s) = %q, want %q", tt.routingKey, tt.body, got, tt.want)
+		}
+	}
+}
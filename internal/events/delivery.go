@@ -0,0 +1,18 @@
+package events
+
+import "time"
+
+// Delivery is a message received from the broker, with the metadata handlers
+// may need besides the body
+type Delivery struct {
+	Exchange      string
+	RoutingKey    string
+	MessageID     string
+	CorrelationID string
+	// Timestamp is when the message was published, zero when the publisher did not set it
+	Timestamp time.Time
+	// Redelivered is set when the message was delivered before without being acknowledged
+	Redelivered bool
+	Headers     map[string]any
+	Body        []byte
+}
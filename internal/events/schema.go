@@ -0,0 +1,170 @@
+package events
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+//go:embed schemas/*.json
+var schemaFiles embed.FS
+
+// SchemaVersionHeader is the AMQP header carrying the schema version of an
+// event, next to the schemaVersion field of the body
+const SchemaVersionHeader = "x-schema-version"
+
+// PublishedSchemaVersion is the schema version of the events this service publishes
+const PublishedSchemaVersion = 1
+
+// ErrInvalidEvent is returned for events that do not match their schema, or
+// whose version cannot be upcast to the current one
+var ErrInvalidEvent = errors.New("invalid event")
+
+// Upcaster converts the body of an event to the next schema version
+type Upcaster func(body []byte) ([]byte, error)
+
+// schema is the current schema of a routing key and the upcasters bringing
+// older versions to it
+type schema struct {
+	version   int
+	schema    *gojsonschema.Schema
+	upcasters map[int]Upcaster
+}
+
+// SchemaRegistry validates consumed events against the JSON Schema of their
+// routing key, upcasting older versions first
+type SchemaRegistry struct {
+	schemas map[string]*schema
+}
+
+// NewSchemaRegistry creates an empty registry
+func NewSchemaRegistry() *SchemaRegistry {
+	return &SchemaRegistry{schemas: make(map[string]*schema)}
+}
+
+// Register sets the current version and JSON Schema of a routing key
+func (r *SchemaRegistry) Register(routingKey string, version int, jsonSchema []byte) error {
+	compiled, err := gojsonschema.NewSchema(gojsonschema.NewBytesLoader(jsonSchema))
+	if err != nil {
+		return fmt.Errorf("schema of %s: %w", routingKey, err)
+	}
+	r.schemas[routingKey] = &schema{version: version, schema: compiled, upcasters: make(map[int]Upcaster)}
+	return nil
+}
+
+// RegisterUpcaster sets how to convert events of a routing key from a version
+// to the next. The routing key must be registered first.
+func (r *SchemaRegistry) RegisterUpcaster(routingKey string, from int, upcaster Upcaster) {
+	r.schemas[routingKey].upcasters[from] = upcaster
+}
+
+// Check upcasts the body of an event to the current version of its routing
+// key and validates it. Routing keys without a schema are accepted as is.
+func (r *SchemaRegistry) Check(routingKey string, version int, body []byte) ([]byte, error) {
+	s, ok := r.schemas[routingKey]
+	if !ok {
+		return body, nil
+	}
+
+	if version > s.version {
+		return nil, fmt.Errorf("%w: %s version %d is newer than the supported %d", ErrInvalidEvent, routingKey, version, s.version)
+	}
+	for ; version < s.version; version++ {
+		upcast, ok := s.upcasters[version]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s version %d cannot be upcast", ErrInvalidEvent, routingKey, version)
+		}
+		var err error
+		if body, err = upcast(body); err != nil {
+			return nil, fmt.Errorf("%w: upcasting %s from version %d: %v", ErrInvalidEvent, routingKey, version, err)
+		}
+	}
+
+	result, err := s.schema.Validate(gojsonschema.NewBytesLoader(body))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEvent, err)
+	}
+	if !result.Valid() {
+		problems := make([]string, len(result.Errors()))
+		for i, e := range result.Errors() {
+			problems[i] = e.String()
+		}
+		return nil, fmt.Errorf("%w: %s", ErrInvalidEvent, strings.Join(problems, "; "))
+	}
+
+	// The type must match the routing key, e.g. no customer.deleted body
+	// published as customer.created
+	var envelope struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(body, &envelope); err == nil && envelope.Type != "" && envelope.Type != routingKey {
+		return nil, fmt.Errorf("%w: type %s does not match routing key %s", ErrInvalidEvent, envelope.Type, routingKey)
+	}
+
+	return body, nil
+}
+
+// SchemaVersion returns the schema version of an event, from its header or
+// else its schemaVersion field. Events without one are version 1.
+func SchemaVersion(headers map[string]any, body []byte) (int, error) {
+	switch v := headers[SchemaVersionHeader].(type) {
+	case int:
+		return v, nil
+	case int8:
+		return int(v), nil
+	case int16:
+		return int(v), nil
+	case int32:
+		return int(v), nil
+	case int64:
+		return int(v), nil
+	case float64:
+		// Headers read back from JSON archives
+		return int(v), nil
+	case string:
+		version, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, fmt.Errorf("%w: schema version header %q is not a number", ErrInvalidEvent, v)
+		}
+		return version, nil
+	}
+
+	var envelope struct {
+		SchemaVersion int `json:"schemaVersion"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidEvent, err)
+	}
+	if envelope.SchemaVersion == 0 {
+		return 1, nil
+	}
+	return envelope.SchemaVersion, nil
+}
+
+// ConsumedSchemas returns the registry of the events this service consumes
+func ConsumedSchemas() (*SchemaRegistry, error) {
+	registry := NewSchemaRegistry()
+	for file, routingKeys := range map[string][]string{
+		"schemas/customer.v1.json":          {"customer.created", "customer.updated", "customer.deleted"},
+		"schemas/order.v1.json":             {"order.created", "order.updated", "order.deleted"},
+		"schemas/snapshot-request.v1.json":  {"product.snapshot.requested"},
+		"schemas/customer-snapshot.v1.json": {"customer.snapshot"},
+		"schemas/order-snapshot.v1.json":    {"order.snapshot"},
+	} {
+		content, err := schemaFiles.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, routingKey := range routingKeys {
+			if err := registry.Register(routingKey, 1, content); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return registry, nil
+}
@@ -0,0 +1,107 @@
+package events_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	localEvents "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/events"
+)
+
+func TestConsumedSchemas(t *testing.T) {
+	registry, err := localEvents.ConsumedSchemas()
+	if err != nil {
+		t.Fatalf("failed to load schemas: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		routingKey string
+		body       string
+		valid      bool
+	}{
+		{"customer", "customer.created", `{"type":"customer.created","customer":{"ID":7,"name":"Ada"}}`, true},
+		{"order", "order.created", `{"type":"order.created","order":{"orderId":42,"customerId":7,"productIds":[1,2]}}`, true},
+		{"missing customer ID", "customer.created", `{"type":"customer.created","customer":{"name":"Ada"}}`, false},
+		{"zero customer ID", "customer.updated", `{"type":"customer.updated","customer":{"ID":0}}`, false},
+		{"renamed order field", "order.created", `{"type":"order.created","order":{"id":42}}`, false},
+		{"type of another key", "customer.created", `{"type":"customer.deleted","customer":{"ID":7}}`, false},
+		{"unknown routing key", "invoice.paid", `{"anything":true}`, true},
+		{"snapshot request", "product.snapshot.requested", `{"type":"product.snapshot.requested","correlationId":"c1","batchSize":50}`, true},
+		{"order snapshot", "order.snapshot", `{"type":"order.snapshot","batch":1,"last":true,"total":1,"orders":[{"orderId":42,"productIds":[1]}]}`, true},
+		{"customer snapshot without batch", "customer.snapshot", `{"type":"customer.snapshot","customers":[]}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := registry.Check(tt.routingKey, 1, []byte(tt.body))
+			if tt.valid && err != nil {
+				t.Errorf("expected valid, got %v", err)
+			}
+			if !tt.valid && !errors.Is(err, localEvents.ErrInvalidEvent) {
+				t.Errorf("expected ErrInvalidEvent, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCheckUpcastsOlderVersions(t *testing.T) {
+	registry := localEvents.NewSchemaRegistry()
+	err := registry.Register("order.created", 2, []byte(`{
+		"type": "object",
+		"required": ["order"],
+		"properties": {"order": {"type": "object", "required": ["orderId"]}}
+	}`))
+	if err != nil {
+		t.Fatalf("failed to register schema: %v", err)
+	}
+	// Version 1 called the field "id"
+	registry.RegisterUpcaster("order.created", 1, func(body []byte) ([]byte, error) {
+		return bytes.Replace(body, []byte(`"id"`), []byte(`"orderId"`), 1), nil
+	})
+
+	body, err := registry.Check("order.created", 1, []byte(`{"order":{"id":42}}`))
+	if err != nil {
+		t.Fatalf("expected the upcast event to be valid, got %v", err)
+	}
+	if string(body) != `{"order":{"orderId":42}}` {
+		t.Errorf("expected the upcast body, got %s", body)
+	}
+
+	if _, err := registry.Check("order.created", 3, body); !errors.Is(err, localEvents.ErrInvalidEvent) {
+		t.Errorf("expected newer versions to be rejected, got %v", err)
+	}
+	if _, err := registry.Check("order.created", 0, body); !errors.Is(err, localEvents.ErrInvalidEvent) {
+		t.Errorf("expected versions without upcaster to be rejected, got %v", err)
+	}
+}
+
+func TestSchemaVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]any
+		body    string
+		want    int
+	}{
+		{"header", map[string]any{localEvents.SchemaVersionHeader: int32(2)}, `{}`, 2},
+		{"string header", map[string]any{localEvents.SchemaVersionHeader: "3"}, `{}`, 3},
+		{"body field", nil, `{"schemaVersion":2}`, 2},
+		{"unversioned", nil, `{"type":"order.created"}`, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := localEvents.SchemaVersion(tt.headers, []byte(tt.body))
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected version %d, got %d", tt.want, got)
+			}
+		})
+	}
+
+	if _, err := localEvents.SchemaVersion(nil, []byte(`not json`)); !errors.Is(err, localEvents.ErrInvalidEvent) {
+		t.Errorf("expected malformed bodies to be invalid, got %v", err)
+	}
+}
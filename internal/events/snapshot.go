@@ -0,0 +1,58 @@
+package events
+
+import (
+	"time"
+
+	"github.com/PayeTonKawa-EPSI-2025/Common-V2/events"
+	"github.com/PayeTonKawa-EPSI-2025/Common-V2/models"
+)
+
+const (
+	ProductSnapshotRequested  events.EventType = "product.snapshot.requested"
+	ProductSnapshot           events.EventType = "product.snapshot"
+	CustomerSnapshotRequested events.EventType = "customer.snapshot.requested"
+	CustomerSnapshot          events.EventType = "customer.snapshot"
+	OrderSnapshotRequested    events.EventType = "order.snapshot.requested"
+	OrderSnapshot             events.EventType = "order.snapshot"
+)
+
+// SnapshotRequest asks the service owning an entity to publish all of them.
+// The snapshot events answering it carry its correlation ID.
+type SnapshotRequest struct {
+	SchemaVersion int              `json:"schemaVersion"`
+	Type          events.EventType `json:"type"`
+	CorrelationID string           `json:"correlationId"`
+	// BatchSize is the number of entities per snapshot event, when set
+	BatchSize int       `json:"batchSize,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Snapshot is one batch of a snapshot. Batches are numbered from 1 and the
+// last one, possibly empty, has Last set and the Total number of entities.
+type Snapshot struct {
+	SchemaVersion int              `json:"schemaVersion"`
+	Type          events.EventType `json:"type"`
+	CorrelationID string           `json:"correlationId"`
+	Batch         int              `json:"batch"`
+	Last          bool             `json:"last"`
+	Total         int              `json:"total"`
+	Timestamp     time.Time        `json:"timestamp"`
+}
+
+// ProductSnapshotEvent is a batch of the product catalogue
+type ProductSnapshotEvent struct {
+	Snapshot
+	Products []models.Product `json:"products"`
+}
+
+// CustomerSnapshotEvent is a batch of the customers of the customer service
+type CustomerSnapshotEvent struct {
+	Snapshot
+	Customers []models.Customer `json:"customers"`
+}
+
+// OrderSnapshotEvent is a batch of the orders of the order service
+type OrderSnapshotEvent struct {
+	Snapshot
+	Orders []events.SimplifiedOrder `json:"orders"`
+}
@@ -0,0 +1,41 @@
+package events
+
+import (
+	"time"
+
+	"github.com/PayeTonKawa-EPSI-2025/Common-V2/events"
+	"github.com/PayeTonKawa-EPSI-2025/Common-V2/models"
+)
+
+const (
+	ProductStockLow   events.EventType = "product.stock_low"
+	ProductOutOfStock events.EventType = "product.out_of_stock"
+)
+
+// StockEvent is published when a product's stock crosses its reorder threshold
+type StockEvent struct {
+	SchemaVersion    int              `json:"schemaVersion"`
+	Type             events.EventType `json:"type"`
+	Product          models.Product   `json:"product"`
+	ReorderThreshold uint             `json:"reorderThreshold"`
+	Timestamp        time.Time        `json:"timestamp"`
+	CorrelationID    string           `json:"correlationId,omitempty"`
+}
+
+// StockAlertFor returns the event to raise when stock moves from before to after,
+// if that change crosses the reorder threshold or empties the stock
+func StockAlertFor(before, after, threshold uint) (events.EventType, bool) {
+	if after >= before {
+		return "", false
+	}
+
+	if after == 0 {
+		return ProductOutOfStock, true
+	}
+
+	if after <= threshold && before > threshold {
+		return ProductStockLow, true
+	}
+
+	return "", false
+}
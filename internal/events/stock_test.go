@@ -0,0 +1,35 @@
+package events_test
+
+import (
+	"testing"
+
+	"github.com/PayeTonKawa-EPSI-2025/Common-V2/events"
+	localEvents "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/events"
+)
+
+func TestStockAlertFor(t *testing.T) {
+	tests := []struct {
+		name      string
+		before    uint
+		after     uint
+		threshold uint
+		want      events.EventType
+	}{
+		{"above threshold", 20, 15, 10, ""},
+		{"crosses threshold", 11, 10, 10, localEvents.ProductStockLow},
+		{"already below threshold", 8, 7, 10, ""},
+		{"runs out", 1, 0, 10, localEvents.ProductOutOfStock},
+		{"runs out without threshold", 3, 0, 0, localEvents.ProductOutOfStock},
+		{"restocked", 0, 50, 10, ""},
+		{"no threshold", 5, 4, 0, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := localEvents.StockAlertFor(tt.before, tt.after, tt.threshold)
+			if got != tt.want || ok != (tt.want != "") {
+				t.Errorf("StockAlertFor(%d, %d, %d) = %q, %v; want %q", tt.before, tt.after, tt.threshold, got, ok, tt.want)
+			}
+		})
+	}
+}
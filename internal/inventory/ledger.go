@@ -0,0 +1,97 @@
+package inventory
+
+import (
+	"errors"
+
+	localModels "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Reasons recorded on stock movements
+const (
+	ReasonOrder      = "order"
+	ReasonRestock    = "restock"
+	ReasonAdjustment = "adjustment"
+	ReasonTransfer   = "transfer"
+	// ReasonReconciliation returns the stock of order lines the order
+	// service no longer has
+	ReasonReconciliation = "reconciliation"
+)
+
+// ErrInsufficientStock is returned when a movement would take stock below zero
+var ErrInsufficientStock = errors.New("insufficient stock")
+
+// Lock loads a product and locks its row until the surrounding transaction ends
+func Lock(tx *gorm.DB, productID uint) (localModels.Product, error) {
+	var product localModels.Product
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&product, productID).Error
+	return product, err
+}
+
+// Move changes the stock of a product locked with Lock by delta in one warehouse
+// and records the movement in the ledger. The product's aggregated stock is kept
+// in sync and product is updated in place with it.
+func Move(tx *gorm.DB, product *localModels.Product, warehouseID uint, delta int, reason, reference string) error {
+	if delta == 0 {
+		return nil
+	}
+
+	if int64(product.Stock)+int64(delta) < 0 {
+		return ErrInsufficientStock
+	}
+
+	if delta > 0 {
+		level := localModels.WarehouseStock{
+			WarehouseID: warehouseID,
+			ProductID:   product.ID,
+			Quantity:    uint(delta),
+		}
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "warehouse_id"}, {Name: "product_id"}},
+			DoUpdates: clause.Assignments(map[string]any{"quantity": gorm.Expr("warehouse_stocks.quantity + ?", delta)}),
+		}).Create(&level).Error
+		if err != nil {
+			return err
+		}
+	} else {
+		result := tx.Model(&localModels.WarehouseStock{}).
+			Where("warehouse_id = ? AND product_id = ? AND quantity >= ?", warehouseID, product.ID, -delta).
+			UpdateColumn("quantity", gorm.Expr("quantity + ?", delta))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInsufficientStock
+		}
+	}
+
+	result := tx.Model(&localModels.Product{}).
+		Where("id = ?", product.ID).
+		UpdateColumn("stock", gorm.Expr("stock + ?", delta))
+	if result.Error != nil {
+		return result.Error
+	}
+
+	movement := localModels.StockMovement{
+		ProductID:   product.ID,
+		WarehouseID: warehouseID,
+		Delta:       delta,
+		Reason:      reason,
+		Reference:   reference,
+	}
+	if err := tx.Create(&movement).Error; err != nil {
+		return err
+	}
+
+	product.Stock = uint(int64(product.Stock) + int64(delta))
+	return nil
+}
+
+// Movements returns the movements recorded with a reason and reference,
+// oldest first
+func Movements(tx *gorm.DB, reason, reference string) ([]localModels.StockMovement, error) {
+	var movements []localModels.StockMovement
+	err := tx.Where("reason = ? AND reference = ?", reason, reference).Order("id").Find(&movements).Error
+	return movements, err
+}
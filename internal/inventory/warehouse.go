@@ -0,0 +1,103 @@
+package inventory
+
+import (
+	"errors"
+	"fmt"
+
+	localModels "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/models"
+	"gorm.io/gorm"
+)
+
+// AllocationStrategy decides which warehouse an order line is taken from
+type AllocationStrategy string
+
+const (
+	// AllocatePriority takes stock from the warehouse with the lowest priority value that has enough
+	AllocatePriority AllocationStrategy = "priority"
+	// AllocateMostStock takes stock from the warehouse holding the most of the product
+	AllocateMostStock AllocationStrategy = "most-stock"
+)
+
+// allocationOrder is the ORDER BY clause ranking candidate warehouses for each strategy
+var allocationOrder = map[AllocationStrategy]string{
+	AllocatePriority:  "warehouses.priority, warehouses.id",
+	AllocateMostStock: "warehouse_stocks.quantity DESC, warehouses.priority, warehouses.id",
+}
+
+// ParseAllocationStrategy parses a strategy name, defaulting to priority when empty
+func ParseAllocationStrategy(name string) (AllocationStrategy, error) {
+	if name == "" {
+		return AllocatePriority, nil
+	}
+
+	strategy := AllocationStrategy(name)
+	if _, ok := allocationOrder[strategy]; !ok {
+		return "", fmt.Errorf("unknown warehouse allocation strategy %q", name)
+	}
+
+	return strategy, nil
+}
+
+// DefaultWarehouse returns the warehouse receiving stock when none is specified
+func DefaultWarehouse(tx *gorm.DB) (localModels.Warehouse, error) {
+	var warehouse localModels.Warehouse
+	err := tx.Where("is_default = ?", true).Order("id").First(&warehouse).Error
+	return warehouse, err
+}
+
+// Allocate takes quantity of a product locked with Lock from a single warehouse
+// chosen by strategy, and returns that warehouse's ID
+func Allocate(tx *gorm.DB, product *localModels.Product, quantity uint, strategy AllocationStrategy, reason, reference string) (uint, error) {
+	order, ok := allocationOrder[strategy]
+	if !ok {
+		order = allocationOrder[AllocatePriority]
+	}
+
+	var level localModels.WarehouseStock
+	err := tx.Joins("JOIN warehouses ON warehouses.id = warehouse_stocks.warehouse_id AND warehouses.deleted_at IS NULL").
+		Where("warehouse_stocks.product_id = ? AND warehouse_stocks.quantity >= ?", product.ID, quantity).
+		Order(order).
+		First(&level).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, ErrInsufficientStock
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if err := Move(tx, product, level.WarehouseID, -int(quantity), reason, reference); err != nil {
+		return 0, err
+	}
+
+	return level.WarehouseID, nil
+}
+
+// Transfer moves quantity of a product from one warehouse to another and records it
+func Transfer(tx *gorm.DB, productID, fromWarehouseID, toWarehouseID, quantity uint) (localModels.StockTransfer, error) {
+	transfer := localModels.StockTransfer{
+		ProductID:       productID,
+		FromWarehouseID: fromWarehouseID,
+		ToWarehouseID:   toWarehouseID,
+		Quantity:        quantity,
+	}
+
+	product, err := Lock(tx, productID)
+	if err != nil {
+		return transfer, err
+	}
+
+	if err := tx.Create(&transfer).Error; err != nil {
+		return transfer, err
+	}
+
+	reference := fmt.Sprintf("transfer:%d", transfer.ID)
+	if err := Move(tx, &product, fromWarehouseID, -int(quantity), ReasonTransfer, reference); err != nil {
+		return transfer, err
+	}
+	if err := Move(tx, &product, toWarehouseID, int(quantity), ReasonTransfer, reference); err != nil {
+		return transfer, err
+	}
+
+	return transfer, nil
+}
@@ -0,0 +1,175 @@
+package inventory_test
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/inventory"
+	localModels "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/models"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func TestParseAllocationStrategy(t *testing.T) {
+	strategy, err := inventory.ParseAllocationStrategy("")
+	if err != nil || strategy != inventory.AllocatePriority {
+		t.Errorf("expected priority by default, got %q, %v", strategy, err)
+	}
+
+	strategy, err = inventory.ParseAllocationStrategy("most-stock")
+	if err != nil || strategy != inventory.AllocateMostStock {
+		t.Errorf("expected most-stock, got %q, %v", strategy, err)
+	}
+
+	if _, err := inventory.ParseAllocationStrategy("random"); err == nil {
+		t.Error("expected an error for an unknown strategy")
+	}
+}
+
+func setupMockDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	dbMock, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+
+	// The functions run in the transaction of their caller
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: dbMock,
+	}), &gorm.Config{SkipDefaultTransaction: true})
+	if err != nil {
+		t.Fatalf("failed to open gorm DB: %v", err)
+	}
+
+	return gormDB, mock
+}
+
+func newProduct(id, stock uint) *localModels.Product {
+	product := &localModels.Product{}
+	product.ID = id
+	product.Stock = stock
+	return product
+}
+
+// expectMove expects the queries of a movement of delta in a warehouse
+func expectMove(mock sqlmock.Sqlmock, productID, warehouseID uint, delta int, reason, reference string) {
+	if delta > 0 {
+		mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "warehouse_stocks" ("warehouse_id","product_id","quantity") VALUES ($1,$2,$3) ON CONFLICT ("warehouse_id","product_id") DO UPDATE SET "quantity"=warehouse_stocks.quantity + $4`)).
+			WithArgs(warehouseID, productID, delta, delta).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	} else {
+		mock.ExpectExec(regexp.QuoteMeta(`UPDATE "warehouse_stocks" SET "quantity"=quantity + $1 WHERE warehouse_id = $2 AND product_id = $3 AND quantity >= $4`)).
+			WithArgs(delta, warehouseID, productID, -delta).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "products" SET "stock"=stock + $1 WHERE id = $2`)).
+		WithArgs(delta, productID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "stock_movements" ("product_id","warehouse_id","delta","reason","reference","created_at") VALUES ($1,$2,$3,$4,$5,$6)`)).
+		WithArgs(productID, warehouseID, delta, reason, reference, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+}
+
+func TestAllocateRanksWarehousesByStrategy(t *testing.T) {
+	cases := []struct {
+		strategy inventory.AllocationStrategy
+		order    string
+	}{
+		{inventory.AllocatePriority, `ORDER BY warehouses.priority, warehouses.id,`},
+		{inventory.AllocateMostStock, `ORDER BY warehouse_stocks.quantity DESC, warehouses.priority, warehouses.id,`},
+	}
+
+	for _, tc := range cases {
+		t.Run(string(tc.strategy), func(t *testing.T) {
+			db, mock := setupMockDB(t)
+			product := newProduct(5, 10)
+
+			mock.ExpectQuery(regexp.QuoteMeta(`FROM "warehouse_stocks" JOIN warehouses ON warehouses.id = warehouse_stocks.warehouse_id AND warehouses.deleted_at IS NULL WHERE warehouse_stocks.product_id = $1 AND warehouse_stocks.quantity >= $2 `+tc.order)).
+				WithArgs(5, 2, 1).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "warehouse_id", "product_id", "quantity"}).AddRow(3, 2, 5, 6))
+			expectMove(mock, 5, 2, -2, inventory.ReasonOrder, "order:1")
+
+			warehouseID, err := inventory.Allocate(db, product, 2, tc.strategy, inventory.ReasonOrder, "order:1")
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if warehouseID != 2 || product.Stock != 8 {
+				t.Errorf("expected 2 units taken from warehouse 2, got warehouse %d and stock %d", warehouseID, product.Stock)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unfulfilled sqlmock expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestAllocateInsufficientStock(t *testing.T) {
+	db, mock := setupMockDB(t)
+	product := newProduct(5, 10)
+
+	// No single warehouse holds enough, nothing is written
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM "warehouse_stocks" JOIN warehouses`)).
+		WithArgs(5, 4, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "warehouse_id", "product_id", "quantity"}))
+
+	_, err := inventory.Allocate(db, product, 4, inventory.AllocatePriority, inventory.ReasonOrder, "order:1")
+	if !errors.Is(err, inventory.ErrInsufficientStock) {
+		t.Fatalf("expected insufficient stock, got %v", err)
+	}
+	if product.Stock != 10 {
+		t.Errorf("expected the stock unchanged, got %d", product.Stock)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled sqlmock expectations: %v", err)
+	}
+}
+
+func TestMoveInsufficientStock(t *testing.T) {
+	db, mock := setupMockDB(t)
+
+	// The total stock is checked before any query
+	if err := inventory.Move(db, newProduct(5, 1), 1, -2, inventory.ReasonAdjustment, "product:5"); !errors.Is(err, inventory.ErrInsufficientStock) {
+		t.Errorf("expected insufficient stock, got %v", err)
+	}
+
+	// The warehouse does not hold enough
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "warehouse_stocks" SET "quantity"=quantity + $1`)).
+		WithArgs(-2, 1, 5, 2).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	if err := inventory.Move(db, newProduct(5, 10), 1, -2, inventory.ReasonAdjustment, "product:5"); !errors.Is(err, inventory.ErrInsufficientStock) {
+		t.Errorf("expected insufficient stock, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled sqlmock expectations: %v", err)
+	}
+}
+
+func TestTransferRecordsBothMovements(t *testing.T) {
+	db, mock := setupMockDB(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "products" WHERE "products"."id" = $1 AND "products"."deleted_at" IS NULL ORDER BY "products"."id" LIMIT $2 FOR UPDATE`)).
+		WithArgs(5, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "stock"}).AddRow(5, 10))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "stock_transfers" ("product_id","from_warehouse_id","to_warehouse_id","quantity","created_at") VALUES ($1,$2,$3,$4,$5)`)).
+		WithArgs(5, 1, 2, 3, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(9))
+	// Out of the first warehouse, then into the second, under one reference
+	expectMove(mock, 5, 1, -3, inventory.ReasonTransfer, "transfer:9")
+	expectMove(mock, 5, 2, 3, inventory.ReasonTransfer, "transfer:9")
+
+	transfer, err := inventory.Transfer(db, 5, 1, 2, 3)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if transfer.ID != 9 {
+		t.Errorf("expected the recorded transfer, got %+v", transfer)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled sqlmock expectations: %v", err)
+	}
+}
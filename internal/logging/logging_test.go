@@ -0,0 +1,130 @@
+package logging_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/logging"
+)
+
+func TestMiddlewarePropagatesRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logging.New(&buf, slog.LevelInfo)
+
+	var seen string
+	handler := logging.Middleware(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = logging.CorrelationID(r.Context())
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/products", nil)
+	req.Header.Set(logging.RequestIDHeader, "abc123")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if seen != "abc123" {
+		t.Errorf("expected correlation ID abc123 in context, got %q", seen)
+	}
+	if got := rec.Header().Get(logging.RequestIDHeader); got != "abc123" {
+		t.Errorf("expected X-Request-ID abc123 in response, got %q", got)
+	}
+
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("log line is not JSON: %v", err)
+	}
+	if entry["correlation_id"] != "abc123" {
+		t.Errorf("expected correlation_id abc123, got %v", entry["correlation_id"])
+	}
+	if entry["status"] != float64(http.StatusTeapot) {
+		t.Errorf("expected status 418, got %v", entry["status"])
+	}
+}
+
+func TestMiddlewareGeneratesRequestID(t *testing.T) {
+	logger := logging.New(&bytes.Buffer{}, slog.LevelInfo)
+	handler := logging.Middleware(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/products", nil))
+
+	if rec.Header().Get(logging.RequestIDHeader) == "" {
+		t.Error("expected a generated X-Request-ID")
+	}
+}
+
+func TestMiddlewareReplacesInvalidRequestID(t *testing.T) {
+	for name, id := range map[string]string{
+		"too long":  strings.Repeat("a", 129),
+		"newline":   "abc\n{\"level\":\"ERROR\"}",
+		"space":     "abc 123",
+		"non-ascii": "abcé",
+		"semicolon": "abc;123",
+	} {
+		t.Run(name, func(t *testing.T) {
+			logger := logging.New(&bytes.Buffer{}, slog.LevelInfo)
+
+			var seen string
+			handler := logging.Middleware(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = logging.CorrelationID(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/products", nil)
+			req.Header.Set(logging.RequestIDHeader, id)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			got := rec.Header().Get(logging.RequestIDHeader)
+			if got == id || got == "" {
+				t.Errorf("expected a generated X-Request-ID, got %q", got)
+			}
+			if seen != got {
+				t.Errorf("expected correlation ID %q in context, got %q", got, seen)
+			}
+		})
+	}
+}
+
+func TestMiddlewareKeepsValidRequestID(t *testing.T) {
+	id := "client-1.retry_2:" + strings.Repeat("A9", 55)
+	handler := logging.Middleware(logging.New(&bytes.Buffer{}, slog.LevelInfo))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest(http.MethodGet, "/products", nil)
+	req.Header.Set(logging.RequestIDHeader, id)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get(logging.RequestIDHeader); got != id {
+		t.Errorf("expected X-Request-ID %q to be kept, got %q", id, got)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	if got := logging.ParseLevel("debug"); got != slog.LevelDebug {
+		t.Errorf("expected debug, got %v", got)
+	}
+	if got := logging.ParseLevel("nonsense"); got != slog.LevelInfo {
+		t.Errorf("expected info fallback, got %v", got)
+	}
+}
+
+func TestValidCorrelationID(t *testing.T) {
+	for id, want := range map[string]bool{
+		"":                        false,
+		"client-1.retry_2:A9":     true,
+		strings.Repeat("a", 128):  true,
+		strings.Repeat("a", 129):  false,
+		"abc\r\nX-Injected: true": false,
+		"abc 123":                 false,
+		"abcé":                    false,
+	} {
+		if got := logging.ValidCorrelationID(id); got != want {
+			t.Errorf("ValidCorrelationID(%q) = %v, want %v", id, got, want)
+		}
+	}
+}
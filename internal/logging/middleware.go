@@ -0,0 +1,47 @@
+package logging
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// RequestIDHeader carries the correlation ID of HTTP requests and responses
+const RequestIDHeader = "X-Request-ID"
+
+// Middleware takes the correlation ID from the X-Request-ID header (or creates
+// one when missing or invalid), echoes it in the response, makes it and the logger available to
+// handlers through the request context, and logs every request once served.
+func Middleware(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(RequestIDHeader)
+			if !ValidCorrelationID(id) {
+				id = NewCorrelationID()
+			}
+			w.Header().Set(RequestIDHeader, id)
+
+			ctx := WithLogger(WithCorrelationID(r.Context(), id), logger)
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			start := time.Now()
+
+			next.ServeHTTP(ww, r.WithContext(ctx))
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			logger.InfoContext(ctx, "HTTP request served",
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", status),
+				slog.Int("bytes", ww.BytesWritten()),
+				slog.Duration("duration", time.Since(start)),
+				slog.String("remote_addr", r.RemoteAddr),
+			)
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package media_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"testing"
+
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/media"
+)
+
+func TestLocalStorage(t *testing.T) {
+	ctx := context.Background()
+	store, err := media.NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+
+	if err := store.Save(ctx, "products/1/a.png", bytes.NewReader([]byte("content"))); err != nil {
+		t.Fatalf("failed to save: %v", err)
+	}
+
+	f, err := store.Open(ctx, "products/1/a.png")
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	content, _ := io.ReadAll(f)
+	f.Close()
+	if string(content) != "content" {
+		t.Errorf("expected stored content, got %q", content)
+	}
+
+	if err := store.Delete(ctx, "products/1/a.png"); err != nil {
+		t.Fatalf("failed to delete: %v", err)
+	}
+	if _, err := store.Open(ctx, "products/1/a.png"); !errors.Is(err, media.ErrNotFound) {
+		t.Errorf("expected ErrNotFound after delete, got %v", err)
+	}
+
+	if err := store.Save(ctx, "../escape", bytes.NewReader(nil)); err == nil {
+		t.Error("expected keys escaping the root to be refused")
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 1024, 512))); err != nil {
+		t.Fatalf("failed to encode source image: %v", err)
+	}
+
+	thumbnail, format, err := media.Thumbnail(&buf)
+	if err != nil {
+		t.Fatalf("failed to create thumbnail: %v", err)
+	}
+	if format != "png" {
+		t.Errorf("expected the png format, got %q", format)
+	}
+
+	img, err := jpeg.Decode(bytes.NewReader(thumbnail))
+	if err != nil {
+		t.Fatalf("thumbnail is not a JPEG: %v", err)
+	}
+	if size := img.Bounds().Size(); size.X != media.ThumbnailSize || size.Y != media.ThumbnailSize/2 {
+		t.Errorf("expected %dx%d thumbnail, got %v", media.ThumbnailSize, media.ThumbnailSize/2, size)
+	}
+}
+
+func TestThumbnailRejectsHugeDimensions(t *testing.T) {
+	// A few bytes of PNG declaring a 100000x100000 image, with no pixel data
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:], 100_000)
+	binary.BigEndian.PutUint32(ihdr[4:], 100_000)
+	ihdr[8], ihdr[9] = 8, 6 // 8 bits per channel, RGBA
+
+	var buf bytes.Buffer
+	buf.WriteString("\x89PNG\r\n\x1a\n")
+	binary.Write(&buf, binary.BigEndian, uint32(len(ihdr)))
+	chunk := append([]byte("IHDR"), ihdr...)
+	buf.Write(chunk)
+	binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(chunk))
+
+	if _, _, err := media.Thumbnail(&buf); !errors.Is(err, media.ErrImageTooLarge) {
+		t.Errorf("expected the image to be refused before decoding, got %v", err)
+	}
+}
@@ -0,0 +1,20 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrNotFound is returned when a stored object does not exist
+var ErrNotFound = errors.New("media not found")
+
+// Storage stores media files under opaque keys
+type Storage interface {
+	// Save writes the content of r under key, replacing any existing object
+	Save(ctx context.Context, key string, r io.Reader) error
+	// Open returns the content stored under key, or ErrNotFound
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the object stored under key; deleting a missing key is not an error
+	Delete(ctx context.Context, key string) error
+}
@@ -0,0 +1,76 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+
+	// Register the decoders for the formats accepted on upload
+	_ "image/gif"
+	_ "image/png"
+
+	"golang.org/x/image/draw"
+)
+
+// ThumbnailSize is the maximum width and height of generated thumbnails
+const ThumbnailSize = 256
+
+// MaxPixels is the largest width × height of an image decoded for its
+// thumbnail. A small compressed file may declare a huge image, whose decoding
+// would exhaust the memory.
+const MaxPixels = 50_000_000
+
+// ErrImageTooLarge is returned for images of more than MaxPixels
+var ErrImageTooLarge = errors.New("image dimensions too large")
+
+// Thumbnail decodes an image and returns a JPEG copy scaled to fit in a
+// ThumbnailSize square, keeping its aspect ratio, with the format of the
+// image as named by its decoder ("jpeg", "png" or "gif"). Smaller images are
+// not enlarged.
+func Thumbnail(r io.Reader) (thumbnail []byte, format string, err error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Check the dimensions in the header before decoding the pixels
+	config, format, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return nil, "", err
+	}
+	if config.Width <= 0 || config.Height <= 0 || int64(config.Width)*int64(config.Height) > MaxPixels {
+		return nil, format, fmt.Errorf("%w: %dx%d", ErrImageTooLarge, config.Width, config.Height)
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, format, err
+	}
+
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > ThumbnailSize || height > ThumbnailSize {
+		if width >= height {
+			height = max(1, height*ThumbnailSize/width)
+			width = ThumbnailSize
+		} else {
+			width = max(1, width*ThumbnailSize/height)
+			height = ThumbnailSize
+		}
+	}
+
+	// JPEG has no transparency, so flatten onto a white background
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Over, nil)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 85}); err != nil {
+		return nil, format, err
+	}
+
+	return buf.Bytes(), format, nil
+}
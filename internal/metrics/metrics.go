@@ -0,0 +1,106 @@
+package metrics
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+
+	chimetrics "github.com/go-chi/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// routingKeyLabels labels consumer metrics by routing key
+type routingKeyLabels struct {
+	RoutingKey string `label:"routing_key"`
+}
+
+// eventTypeLabels labels publisher metrics by event type
+type eventTypeLabels struct {
+	EventType string `label:"event_type"`
+}
+
+// productLabels labels stock metrics by product
+type productLabels struct {
+	ProductID string `label:"product_id"`
+}
+
+// Metrics are registered on the default registry, served on /metrics next to
+// the HTTP collector metrics
+var (
+	eventsConsumed = chimetrics.CounterWith[routingKeyLabels]("events_consumed_total", "Total number of events received from RabbitMQ.")
+	eventsFailed   = chimetrics.CounterWith[routingKeyLabels]("events_failed_total", "Total number of events whose handler returned an error.")
+	eventsAcked    = chimetrics.CounterWith[routingKeyLabels]("events_acked_total", "Total number of events acknowledged to RabbitMQ.")
+	eventsRejected = chimetrics.CounterWith[routingKeyLabels]("events_rejected_total", "Total number of events rejected to the dead letter exchange.")
+	handlerPanics  = chimetrics.CounterWith[routingKeyLabels]("event_handler_panics_total", "Total number of events whose handler panicked.")
+
+	handlerDuration = chimetrics.HistogramWith[routingKeyLabels](
+		"event_handler_duration_seconds",
+		"Time spent handling a consumed event, in seconds.",
+		[]float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	)
+	consumeLag = chimetrics.HistogramWith[routingKeyLabels](
+		"event_consume_lag_seconds",
+		"Age of consumed events when handling starts (time spent in the queue), in seconds.",
+		[]float64{.01, .05, .1, .5, 1, 5, 10, 30, 60, 300, 900, 3600},
+	)
+
+	eventsPublished = chimetrics.CounterWith[eventTypeLabels]("events_published_total", "Total number of events published to RabbitMQ.")
+	publishFailures = chimetrics.CounterWith[eventTypeLabels]("event_publish_failures_total", "Total number of events that could not be published.")
+
+	stockOuts = chimetrics.CounterWith[productLabels]("product_stock_outs_total", "Total number of times a product ran out of stock.")
+)
+
+// EventConsumed records an event received for the routing key, and how long
+// it waited in the queue when the publisher set a timestamp
+func EventConsumed(routingKey string, publishedAt time.Time) {
+	labels := routingKeyLabels{RoutingKey: routingKey}
+	eventsConsumed.Inc(labels)
+	if !publishedAt.IsZero() {
+		consumeLag.Observe(time.Since(publishedAt).Seconds(), labels)
+	}
+}
+
+// EventHandled records the duration of a handler and whether it failed
+func EventHandled(routingKey string, duration time.Duration, err error) {
+	labels := routingKeyLabels{RoutingKey: routingKey}
+	handlerDuration.Observe(duration.Seconds(), labels)
+	if err != nil {
+		eventsFailed.Inc(labels)
+	}
+}
+
+// EventAcked records an acknowledged event
+func EventAcked(routingKey string) {
+	eventsAcked.Inc(routingKeyLabels{RoutingKey: routingKey})
+}
+
+// EventRejected records an event rejected without requeueing
+func EventRejected(routingKey string) {
+	eventsRejected.Inc(routingKeyLabels{RoutingKey: routingKey})
+}
+
+// HandlerPanicked records a handler panic
+func HandlerPanicked(routingKey string) {
+	handlerPanics.Inc(routingKeyLabels{RoutingKey: routingKey})
+}
+
+// EventPublished records the outcome of publishing an event
+func EventPublished(eventType string, err error) {
+	labels := eventTypeLabels{EventType: eventType}
+	if err != nil {
+		publishFailures.Inc(labels)
+		return
+	}
+	eventsPublished.Inc(labels)
+}
+
+// StockOut records a product running out of stock
+func StockOut(productID uint) {
+	stockOuts.Inc(productLabels{ProductID: strconv.FormatUint(uint64(productID), 10)})
+}
+
+// RegisterDBStats exposes the connection pool statistics of the database
+func RegisterDBStats(db *sql.DB) error {
+	return prometheus.Register(collectors.NewDBStatsCollector(db, "products"))
+}
@@ -0,0 +1,77 @@
+package metrics_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestConsumerMetrics(t *testing.T) {
+	metrics.EventConsumed("order.created", time.Now().Add(-2*time.Second))
+	metrics.EventHandled("order.created", 10*time.Millisecond, errors.New("boom"))
+	metrics.EventAcked("order.created")
+
+	expected := `
+# HELP events_failed_total Total number of events whose handler returned an error.
+# TYPE events_failed_total counter
+events_failed_total{routing_key="order.created"} 1
+# HELP events_acked_total Total number of events acknowledged to RabbitMQ.
+# TYPE events_acked_total counter
+events_acked_total{routing_key="order.created"} 1
+`
+	if err := testutil.GatherAndCompare(prometheus.DefaultGatherer, strings.NewReader(expected), "events_failed_total", "events_acked_total"); err != nil {
+		t.Error(err)
+	}
+
+	count, err := testutil.GatherAndCount(prometheus.DefaultGatherer, "event_consume_lag_seconds", "event_handler_duration_seconds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("expected lag and duration histograms, got %d series", count)
+	}
+}
+
+func TestPublisherMetrics(t *testing.T) {
+	metrics.EventPublished("product.updated", nil)
+	metrics.EventPublished("product.updated", errors.New("channel closed"))
+	metrics.StockOut(42)
+
+	expected := `
+# HELP event_publish_failures_total Total number of events that could not be published.
+# TYPE event_publish_failures_total counter
+event_publish_failures_total{event_type="product.updated"} 1
+# HELP events_published_total Total number of events published to RabbitMQ.
+# TYPE events_published_total counter
+events_published_total{event_type="product.updated"} 1
+# HELP product_stock_outs_total Total number of times a product ran out of stock.
+# TYPE product_stock_outs_total counter
+product_stock_outs_total{product_id="42"} 1
+`
+	if err := testutil.GatherAndCompare(prometheus.DefaultGatherer, strings.NewReader(expected),
+		"events_published_total", "event_publish_failures_total", "product_stock_outs_total"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRejectedMetrics(t *testing.T) {
+	metrics.HandlerPanicked("customer.updated")
+	metrics.EventRejected("customer.updated")
+
+	expected := `
+# HELP event_handler_panics_total Total number of events whose handler panicked.
+# TYPE event_handler_panics_total counter
+event_handler_panics_total{routing_key="customer.updated"} 1
+# HELP events_rejected_total Total number of events rejected to the dead letter exchange.
+# TYPE events_rejected_total counter
+events_rejected_total{routing_key="customer.updated"} 1
+`
+	if err := testutil.GatherAndCompare(prometheus.DefaultGatherer, strings.NewReader(expected), "event_handler_panics_total", "events_rejected_total"); err != nil {
+		t.Error(err)
+	}
+}
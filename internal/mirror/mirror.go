@@ -0,0 +1,97 @@
+// Package mirror keeps the local copies of the customers and orders owned
+// by the customer and order services up to date
+package mirror
+
+import (
+	"time"
+
+	"github.com/PayeTonKawa-EPSI-2025/Common-V2/models"
+	localModels "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Customer converts a customer of the customer service as known at syncedAt,
+// now when zero
+func Customer(customer models.Customer, syncedAt time.Time) localModels.Customer {
+	local := localModels.Customer{
+		Username:    customer.Username,
+		FirstName:   customer.FirstName,
+		LastName:    customer.LastName,
+		Name:        customer.Name,
+		CompanyName: customer.Company.CompanyName,
+		SyncedAt:    orNow(syncedAt),
+	}
+	local.ID = customer.ID
+	return local
+}
+
+// Order converts an order of the order service as known at syncedAt, now
+// when zero. It is placed at syncedAt, kept for orders already known.
+func Order(orderID, customerID uint, syncedAt time.Time) localModels.Order {
+	local := localModels.Order{
+		CustomerID: customerID,
+		Status:     localModels.OrderStatusPlaced,
+		PlacedAt:   orNow(syncedAt),
+		SyncedAt:   orNow(syncedAt),
+	}
+	local.ID = orderID
+	return local
+}
+
+func orNow(t time.Time) time.Time {
+	if t.IsZero() {
+		return time.Now()
+	}
+	return t
+}
+
+// newer only updates rows last synced before the values written, so events
+// handled out of order do not bring back older values
+func newer(table string) clause.Where {
+	return clause.Where{Exprs: []clause.Expression{
+		clause.Expr{SQL: `"` + table + `"."synced_at" IS NULL OR "` + table + `"."synced_at" <= excluded."synced_at"`},
+	}}
+}
+
+// SaveCustomers inserts the customers, or updates the known ones with newer
+// values. Deleted customers stay deleted.
+func SaveCustomers(tx *gorm.DB, customers ...localModels.Customer) error {
+	if len(customers) == 0 {
+		return nil
+	}
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"updated_at", "username", "first_name", "last_name", "name", "company_name", "synced_at"}),
+		Where:     newer("customers"),
+	}).Create(&customers).Error
+}
+
+// SaveOrders inserts the orders, or updates the customer of the known ones
+// with newer values. Their status and placement time are kept.
+func SaveOrders(tx *gorm.DB, orders ...localModels.Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+	return tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "id"}},
+		DoUpdates: clause.Set{
+			{Column: clause.Column{Name: "updated_at"}, Value: gorm.Expr("excluded.updated_at")},
+			{Column: clause.Column{Name: "customer_id"}, Value: gorm.Expr("excluded.customer_id")},
+			{Column: clause.Column{Name: "placed_at"}, Value: gorm.Expr(`COALESCE("orders"."placed_at", excluded.placed_at)`)},
+			{Column: clause.Column{Name: "synced_at"}, Value: gorm.Expr("excluded.synced_at")},
+		},
+		Where: newer("orders"),
+	}).Create(&orders).Error
+}
+
+// CancelOrder marks an order cancelled and deletes it
+func CancelOrder(tx *gorm.DB, orderID uint, syncedAt time.Time) error {
+	err := tx.Model(&localModels.Order{}).
+		Where("id = ?", orderID).
+		Updates(map[string]any{"status": localModels.OrderStatusCancelled, "synced_at": orNow(syncedAt)}).Error
+	if err != nil {
+		return err
+	}
+	return tx.Delete(&localModels.Order{}, orderID).Error
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ArchivedEvent records a consumed or published message, with how it went
+type ArchivedEvent struct {
+	ID uint `json:"id" gorm:"primaryKey"`
+	// Direction is "consumed" or "published"
+	Direction  string `json:"direction"`
+	RoutingKey string `json:"routingKey" gorm:"index"`
+	// EntityID is the ID of the customer, order or product the event is about
+	EntityID      string          `json:"entityId,omitempty" gorm:"index"`
+	MessageID     string          `json:"messageId,omitempty"`
+	CorrelationID string          `json:"correlationId,omitempty"`
+	Headers       json.RawMessage `json:"headers,omitempty" gorm:"type:jsonb"`
+	Body          json.RawMessage `json:"body" gorm:"type:jsonb"`
+	// Outcome is "handled", "failed", "rejected" or "published"
+	Outcome string `json:"outcome"`
+	Error   string `json:"error,omitempty"`
+	// DurationMs is the time spent handling or publishing the message
+	DurationMs int64 `json:"durationMs"`
+	// Timestamp is when the message was published
+	Timestamp  time.Time `json:"timestamp"`
+	RecordedAt time.Time `json:"recordedAt" gorm:"index"`
+}
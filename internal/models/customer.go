@@ -1,7 +1,20 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"time"
 
+	"gorm.io/gorm"
+)
+
+// Customer mirrors the customers of the customer service
 type Customer struct {
 	gorm.Model
+	Username  string `json:"username"`
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+	Name      string `json:"name"`
+	// CompanyName groups the customers buying for a same company
+	CompanyName string `json:"companyName"`
+	// SyncedAt is the time of the last event applied, older ones are ignored
+	SyncedAt time.Time `json:"syncedAt"`
 }
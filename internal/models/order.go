@@ -1,7 +1,26 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"time"
 
+	"gorm.io/gorm"
+)
+
+// OrderStatus is the lifecycle state of an order, as far as the events tell
+type OrderStatus string
+
+const (
+	OrderStatusPlaced    OrderStatus = "placed"
+	OrderStatusCancelled OrderStatus = "cancelled"
+)
+
+// Order mirrors the orders of the order service
 type Order struct {
 	gorm.Model
+	CustomerID uint        `json:"customerId" gorm:"index"`
+	Status     OrderStatus `json:"status" gorm:"default:placed"`
+	// PlacedAt is the time of the order.created event
+	PlacedAt time.Time `json:"placedAt"`
+	// SyncedAt is the time of the last event applied, older ones are ignored
+	SyncedAt time.Time `json:"syncedAt"`
 }
@@ -8,4 +8,7 @@ type OrderProduct struct {
 	Order     Order          `gorm:"foreignKey:OrderID"`
 	ProductID uint           `json:"productId"`
 	Product   models.Product `gorm:"foreignKey:ProductID"`
+	// WarehouseID is the warehouse the product was allocated from, 0 for orders
+	// seeded from a snapshot
+	WarehouseID uint `json:"warehouseId"`
 }
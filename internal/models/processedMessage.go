@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// ProcessedMessage records a consumed message that was handled successfully,
+// so a redelivery of it is skipped
+type ProcessedMessage struct {
+	MessageID   string `gorm:"primaryKey"`
+	RoutingKey  string
+	ProcessedAt time.Time `gorm:"index"`
+}
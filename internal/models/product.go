@@ -0,0 +1,41 @@
+package models
+
+import "github.com/PayeTonKawa-EPSI-2025/Common-V2/models"
+
+// ProductStatus is the lifecycle state of a product
+type ProductStatus string
+
+const (
+	ProductStatusDraft        ProductStatus = "draft"
+	ProductStatusActive       ProductStatus = "active"
+	ProductStatusDiscontinued ProductStatus = "discontinued"
+)
+
+// productTransitions lists the statuses a product may move to from each status
+var productTransitions = map[ProductStatus][]ProductStatus{
+	ProductStatusDraft:        {ProductStatusActive, ProductStatusDiscontinued},
+	ProductStatusActive:       {ProductStatusDiscontinued},
+	ProductStatusDiscontinued: {ProductStatusActive},
+}
+
+// CanTransitionTo reports whether a product may move from s to next
+func (s ProductStatus) CanTransitionTo(next ProductStatus) bool {
+	for _, allowed := range productTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// Product extends the shared product model with the fields owned by this service
+type Product struct {
+	models.Product
+	Status ProductStatus `json:"status" gorm:"column:status;default:active;index"`
+	// ReorderThreshold is the stock level at or below which the product is reported as running low
+	ReorderThreshold uint `json:"reorderThreshold" gorm:"column:reorder_threshold;default:0"`
+	// WarehouseStocks breaks Stock down per warehouse; only loaded for single product lookups
+	WarehouseStocks []WarehouseStock `json:"warehouseStocks,omitempty" gorm:"foreignKey:ProductID"`
+	// Images are the product photos in display order; only loaded for single product lookups
+	Images []ProductImage `json:"images,omitempty" gorm:"foreignKey:ProductID"`
+}
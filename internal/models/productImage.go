@@ -0,0 +1,39 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ProductImage is a photo attached to a product, shown in Position order
+type ProductImage struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	ProductID    uint      `json:"productId" gorm:"index"`
+	Position     int       `json:"position"`
+	Filename     string    `json:"filename"`
+	ContentType  string    `json:"contentType"`
+	Size         int64     `json:"size"`
+	StorageKey   string    `json:"-"`
+	ThumbnailKey string    `json:"-"`
+	URL          string    `json:"url" gorm:"-"`
+	ThumbnailURL string    `json:"thumbnailUrl" gorm:"-"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+func (i *ProductImage) AfterFind(tx *gorm.DB) error {
+	i.fillURLs()
+	return nil
+}
+
+func (i *ProductImage) AfterCreate(tx *gorm.DB) error {
+	i.fillURLs()
+	return nil
+}
+
+// fillURLs sets the API paths serving the image and its thumbnail
+func (i *ProductImage) fillURLs() {
+	i.URL = fmt.Sprintf("/products/%d/images/%d", i.ProductID, i.ID)
+	i.ThumbnailURL = i.URL + "/thumbnail"
+}
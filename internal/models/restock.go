@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type Supplier struct {
+	gorm.Model
+	Name  string `json:"name" gorm:"column:name"`
+	Email string `json:"email" gorm:"column:email"`
+}
+
+// RestockStatus is the state of an inbound shipment
+type RestockStatus string
+
+const (
+	RestockStatusPending   RestockStatus = "pending"
+	RestockStatusReceived  RestockStatus = "received"
+	RestockStatusCancelled RestockStatus = "cancelled"
+)
+
+// Restock is an inbound shipment expected from a supplier
+type Restock struct {
+	gorm.Model
+	SupplierID uint     `json:"supplierId"`
+	Supplier   Supplier `json:"-" gorm:"foreignKey:SupplierID"`
+	// WarehouseID is the warehouse the shipment is delivered to
+	WarehouseID uint          `json:"warehouseId"`
+	Warehouse   Warehouse     `json:"-" gorm:"foreignKey:WarehouseID"`
+	Status      RestockStatus `json:"status" gorm:"column:status;default:pending;index"`
+	ExpectedAt  *time.Time    `json:"expectedAt,omitempty" gorm:"column:expected_at"`
+	ReceivedAt  *time.Time    `json:"receivedAt,omitempty" gorm:"column:received_at"`
+	Lines       []RestockLine `json:"lines" gorm:"foreignKey:RestockID"`
+}
+
+type RestockLine struct {
+	ID        uint    `json:"id" gorm:"primaryKey"`
+	RestockID uint    `json:"restockId" gorm:"index"`
+	ProductID uint    `json:"productId"`
+	Product   Product `json:"-" gorm:"foreignKey:ProductID"`
+	Quantity  uint    `json:"quantity"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// StockMovement is one entry of the stock ledger: every change to a product's stock is recorded here
+type StockMovement struct {
+	ID        uint    `json:"id" gorm:"primaryKey"`
+	ProductID uint    `json:"productId" gorm:"index"`
+	Product   Product `json:"-" gorm:"foreignKey:ProductID"`
+	// WarehouseID is the warehouse whose stock changed
+	WarehouseID uint      `json:"warehouseId" gorm:"index"`
+	Warehouse   Warehouse `json:"-" gorm:"foreignKey:WarehouseID"`
+	Delta       int       `json:"delta"`
+	Reason      string    `json:"reason"`
+	Reference   string    `json:"reference"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
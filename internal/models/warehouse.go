@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type Warehouse struct {
+	gorm.Model
+	Code string `json:"code" gorm:"column:code;uniqueIndex"`
+	Name string `json:"name" gorm:"column:name"`
+	// Priority orders warehouses for allocation, lowest first
+	Priority int `json:"priority" gorm:"column:priority;default:0"`
+	// IsDefault marks the warehouse receiving stock when none is specified
+	IsDefault bool `json:"isDefault" gorm:"column:is_default;default:false"`
+}
+
+// WarehouseStock is the stock level of a product in one warehouse
+type WarehouseStock struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	WarehouseID uint      `json:"warehouseId" gorm:"uniqueIndex:idx_warehouse_product"`
+	Warehouse   Warehouse `json:"-" gorm:"foreignKey:WarehouseID"`
+	ProductID   uint      `json:"productId" gorm:"uniqueIndex:idx_warehouse_product"`
+	Quantity    uint      `json:"quantity"`
+}
+
+// StockTransfer records stock moved from one warehouse to another
+type StockTransfer struct {
+	ID              uint      `json:"id" gorm:"primaryKey"`
+	ProductID       uint      `json:"productId" gorm:"index"`
+	Product         Product   `json:"-" gorm:"foreignKey:ProductID"`
+	FromWarehouseID uint      `json:"fromWarehouseId"`
+	FromWarehouse   Warehouse `json:"-" gorm:"foreignKey:FromWarehouseID"`
+	ToWarehouseID   uint      `json:"toWarehouseId"`
+	ToWarehouse     Warehouse `json:"-" gorm:"foreignKey:ToWarehouseID"`
+	Quantity        uint      `json:"quantity"`
+	CreatedAt       time.Time `json:"createdAt"`
+}
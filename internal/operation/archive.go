@@ -0,0 +1,118 @@
+package operation
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/dto"
+	localEvents "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/events"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/logging"
+	localModels "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/models"
+	"github.com/danielgtaylor/huma/v2"
+	"gorm.io/gorm"
+)
+
+// ----------------------
+// Extracted Event Archive Functions
+// ----------------------
+
+// archiveQuery restricts a query of the archived events to a filter
+func archiveQuery(db *gorm.DB, filter dto.ArchivedEventsFilter) *gorm.DB {
+	query := db.Model(&localModels.ArchivedEvent{})
+	if filter.Type != "" {
+		query = query.Where("routing_key = ?", filter.Type)
+	}
+	if filter.EntityID != "" {
+		query = query.Where("entity_id = ?", filter.EntityID)
+	}
+	if filter.Direction != "" && filter.Direction != "all" {
+		query = query.Where("direction = ?", filter.Direction)
+	}
+	if filter.Outcome != "" && filter.Outcome != "all" {
+		query = query.Where("outcome = ?", filter.Outcome)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("recorded_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("recorded_at < ?", filter.To)
+	}
+	return query
+}
+
+// Get the archived messages matching a filter, newest first
+func GetArchivedEvents(ctx context.Context, db *gorm.DB, input *dto.ArchivedEventsInput) (*dto.ArchivedEventsOutput, error) {
+	resp := &dto.ArchivedEventsOutput{}
+
+	var archived []localModels.ArchivedEvent
+	results := archiveQuery(db, input.ArchivedEventsFilter).Order("id DESC").Limit(input.Limit).Find(&archived)
+
+	if results.Error == nil {
+		resp.Body.Events = archived
+	}
+
+	return resp, results.Error
+}
+
+// ExportArchivedEvents writes the archived messages matching a filter as an
+// NDJSON archive, oldest first, the format the replay command reads
+func ExportArchivedEvents(ctx context.Context, db *gorm.DB, filter dto.ArchivedEventsFilter, w io.Writer) error {
+	enc := json.NewEncoder(w)
+
+	var batch []localModels.ArchivedEvent
+	return archiveQuery(db, filter).FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+		for _, archived := range batch {
+			var headers map[string]any
+			_ = json.Unmarshal(archived.Headers, &headers)
+
+			if err := enc.Encode(localEvents.ArchivedMessage{
+				RoutingKey:    archived.RoutingKey,
+				MessageID:     archived.MessageID,
+				CorrelationID: archived.CorrelationID,
+				Timestamp:     archived.Timestamp,
+				Headers:       headers,
+				Body:          archived.Body,
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+}
+
+// ----------------------
+// Register routes with Huma
+// ----------------------
+
+func RegisterArchiveRoutes(api huma.API, dbConn *gorm.DB) {
+	huma.Register(api, huma.Operation{
+		OperationID: "get-archived-events",
+		Summary:     "Get the archived consumed and published messages",
+		Method:      http.MethodGet,
+		Path:        "/admin/events",
+		Tags:        []string{"admin"},
+	}, func(ctx context.Context, input *dto.ArchivedEventsInput) (*dto.ArchivedEventsOutput, error) {
+		return GetArchivedEvents(ctx, dbConn.WithContext(ctx), input)
+	})
+
+	huma.Register(api, huma.Operation{
+		OperationID: "export-archived-events",
+		Summary:     "Export the archived messages as NDJSON, for the replay command",
+		Method:      http.MethodGet,
+		Path:        "/admin/events/export",
+		Tags:        []string{"admin"},
+	}, func(ctx context.Context, input *dto.ArchivedEventsExportInput) (*huma.StreamResponse, error) {
+		return &huma.StreamResponse{
+			Body: func(hctx huma.Context) {
+				hctx.SetHeader("Content-Type", "application/x-ndjson")
+				if err := ExportArchivedEvents(ctx, dbConn.WithContext(ctx), input.ArchivedEventsFilter, hctx.BodyWriter()); err != nil {
+					// The status is already sent, the archive ends early
+					logging.FromContext(ctx).ErrorContext(ctx, "Failed to export archived events", slog.Any("error", err))
+				}
+			},
+		}, nil
+	})
+}
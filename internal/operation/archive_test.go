@@ -0,0 +1,71 @@
+package operation_test
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/dto"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/operation"
+)
+
+func TestGetArchivedEventsFilters(t *testing.T) {
+	db, mock := setupMockDB(t)
+
+	from := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "archived_events" WHERE routing_key = $1 AND entity_id = $2 AND direction = $3 AND recorded_at >= $4 ORDER BY id DESC LIMIT $5`)).
+		WithArgs("order.created", "42", "consumed", from, 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "direction", "routing_key", "entity_id", "outcome", "body"}).
+			AddRow(7, "consumed", "order.created", "42", "failed", []byte(`{"order":{"orderId":42}}`)))
+
+	input := &dto.ArchivedEventsInput{Limit: 10}
+	input.Type = "order.created"
+	input.EntityID = "42"
+	input.Direction = "consumed"
+	input.Outcome = "all"
+	input.From = from
+
+	resp, err := operation.GetArchivedEvents(context.Background(), db, input)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(resp.Body.Events) != 1 || resp.Body.Events[0].Outcome != "failed" {
+		t.Errorf("expected the archived event, got %+v", resp.Body.Events)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled sqlmock expectations: %v", err)
+	}
+}
+
+func TestExportArchivedEvents(t *testing.T) {
+	db, mock := setupMockDB(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "archived_events" WHERE outcome = $1 ORDER BY "archived_events"."id" LIMIT $2`)).
+		WithArgs("failed", 500).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "routing_key", "message_id", "headers", "body"}).
+			AddRow(1, "order.created", "m1", []byte(`{"x-schema-version":1}`), []byte(`{"order":{"orderId":1}}`)).
+			AddRow(2, "customer.created", "m2", nil, []byte(`{"customer":{"ID":2}}`)))
+
+	var out bytes.Buffer
+	err := operation.ExportArchivedEvents(context.Background(), db, dto.ArchivedEventsFilter{Outcome: "failed"}, &out)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected one line per event, got %q", out.String())
+	}
+	if !strings.Contains(lines[0], `"routingKey":"order.created","messageId":"m1"`) || !strings.Contains(lines[0], `"headers":{"x-schema-version":1},"body":{"order":{"orderId":1}}`) {
+		t.Errorf("unexpected line %s", lines[0])
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled sqlmock expectations: %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package operation
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/dto"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/health"
+	"github.com/danielgtaylor/huma/v2"
+)
+
+// ----------------------
+// Extracted Health Functions
+// ----------------------
+
+// Check every dependency, reporting 503 when one of them is down
+func GetReadiness(ctx context.Context, checker *health.Checker) (*dto.ReadinessOutput, error) {
+	resp := &dto.ReadinessOutput{Status: http.StatusOK}
+
+	ready, results := checker.Run(ctx)
+
+	resp.Body.Status = health.StatusUp
+	resp.Body.Checks = results
+	if !ready {
+		resp.Status = http.StatusServiceUnavailable
+		resp.Body.Status = health.StatusDown
+	}
+
+	return resp, nil
+}
+
+// ----------------------
+// Register routes with Huma
+// ----------------------
+
+func RegisterHealthRoutes(api huma.API, checker *health.Checker) {
+	huma.Register(api, huma.Operation{
+		OperationID: "livez",
+		Summary:     "Liveness probe",
+		Description: "Reports the process is running, without checking its dependencies.",
+		Method:      http.MethodGet,
+		Path:        "/livez",
+		Tags:        []string{"health"},
+	}, func(ctx context.Context, input *struct{}) (*dto.LivenessOutput, error) {
+		resp := &dto.LivenessOutput{}
+		resp.Body.Status = health.StatusUp
+		return resp, nil
+	})
+
+	huma.Register(api, huma.Operation{
+		OperationID: "readyz",
+		Summary:     "Readiness probe",
+		Description: "Checks the database, RabbitMQ and the backlog of the consumed queue, returning 503 when one of them is down.",
+		Method:      http.MethodGet,
+		Path:        "/readyz",
+		Tags:        []string{"health"},
+		Responses: map[string]*huma.Response{
+			"503": {Description: "A dependency is down"},
+		},
+	}, func(ctx context.Context, input *struct{}) (*dto.ReadinessOutput, error) {
+		return GetReadiness(ctx, checker)
+	})
+
+	// Kept for the clients of the former health check
+	huma.Register(api, huma.Operation{
+		OperationID: "health",
+		Summary:     "Health check, alias of the readiness probe",
+		Method:      http.MethodGet,
+		Path:        "/health",
+		Tags:        []string{"health"},
+		Deprecated:  true,
+		Responses: map[string]*huma.Response{
+			"503": {Description: "A dependency is down"},
+		},
+	}, func(ctx context.Context, input *struct{}) (*dto.ReadinessOutput, error) {
+		return GetReadiness(ctx, checker)
+	})
+}
@@ -0,0 +1,58 @@
+package operation_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/health"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/operation"
+	"github.com/danielgtaylor/huma/v2/humatest"
+)
+
+func TestReadinessReportsDependencies(t *testing.T) {
+	db, mock := setupMockDB(t)
+	mock.ExpectPing()
+
+	checker := health.NewChecker(time.Second)
+	checker.Add("database", health.Database(db))
+
+	resp, err := operation.GetReadiness(context.Background(), checker)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if resp.Status != http.StatusOK || resp.Body.Status != health.StatusUp {
+		t.Errorf("expected ready, got %d %s", resp.Status, resp.Body.Status)
+	}
+	if resp.Body.Checks["database"].Status != health.StatusUp {
+		t.Errorf("expected database up, got %+v", resp.Body.Checks["database"])
+	}
+}
+
+func TestReadinessUnavailableWhenDependencyDown(t *testing.T) {
+	_, api := humatest.New(t)
+
+	checker := health.NewChecker(time.Second)
+	checker.Add("database", func(ctx context.Context) error { return nil })
+	checker.Add("rabbitmq", func(ctx context.Context) error { return errors.New("channel closed") })
+	operation.RegisterHealthRoutes(api, checker)
+
+	resp := api.Get("/readyz")
+	if resp.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", resp.Code)
+	}
+	if !strings.Contains(resp.Body.String(), "channel closed") {
+		t.Errorf("expected the failing check in the body, got %s", resp.Body.String())
+	}
+
+	if resp := api.Get("/livez"); resp.Code != http.StatusOK {
+		t.Errorf("expected liveness to stay 200, got %d", resp.Code)
+	}
+	if resp := api.Get("/health"); resp.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected the health alias to report readiness, got %d", resp.Code)
+	}
+}
@@ -0,0 +1,373 @@
+package operation
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/dto"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/logging"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/media"
+	localModels "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/models"
+	"github.com/danielgtaylor/huma/v2"
+	"gorm.io/gorm"
+)
+
+// maxImageBytes is the largest accepted image upload
+const maxImageBytes = 10 << 20
+
+// imageFormat is the content type and file extension of an accepted format
+type imageFormat struct {
+	contentType string
+	extension   string
+}
+
+// imageFormats maps the accepted formats, as named by the image decoders, to
+// their content type and file extension
+var imageFormats = map[string]imageFormat{
+	"jpeg": {contentType: "image/jpeg", extension: ".jpg"},
+	"png":  {contentType: "image/png", extension: ".png"},
+	"gif":  {contentType: "image/gif", extension: ".gif"},
+}
+
+// acceptedContentType reports whether uploads may declare the content type
+func acceptedContentType(contentType string) bool {
+	for _, format := range imageFormats {
+		if format.contentType == contentType {
+			return true
+		}
+	}
+	return false
+}
+
+// ----------------------
+// Extracted Image Functions
+// ----------------------
+
+// Get the images of a product in display order
+func GetProductImages(ctx context.Context, db *gorm.DB, productID uint) (*dto.ProductImagesOutput, error) {
+	resp := &dto.ProductImagesOutput{}
+
+	if err := findProduct(db, productID); err != nil {
+		return nil, err
+	}
+
+	var images []localModels.ProductImage
+	results := db.Where("product_id = ?", productID).Order("position, id").Find(&images)
+
+	if results.Error == nil {
+		resp.Body.Images = images
+	}
+
+	return resp, results.Error
+}
+
+// Store an uploaded image and its thumbnail, appending it to the product's images
+func UploadProductImage(ctx context.Context, db *gorm.DB, store media.Storage, productID uint, file huma.FormFile) (*dto.ProductImageOutput, error) {
+	resp := &dto.ProductImageOutput{}
+
+	if err := findProduct(db, productID); err != nil {
+		return nil, err
+	}
+
+	if !acceptedContentType(file.ContentType) {
+		return nil, huma.NewError(http.StatusUnsupportedMediaType, "Only JPEG, PNG and GIF images are accepted")
+	}
+
+	content, err := io.ReadAll(io.LimitReader(file, maxImageBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(content) > maxImageBytes {
+		return nil, huma.NewError(http.StatusRequestEntityTooLarge, "Image is too large")
+	}
+
+	thumbnail, decoded, err := media.Thumbnail(bytes.NewReader(content))
+	if errors.Is(err, media.ErrImageTooLarge) {
+		return nil, huma.NewError(http.StatusRequestEntityTooLarge, "Image dimensions are too large", err)
+	}
+	if err != nil {
+		return nil, huma.NewError(http.StatusUnprocessableEntity, "File is not a valid image", err)
+	}
+
+	// The stored and served type is the decoded one, never the declared one
+	format, ok := imageFormats[decoded]
+	if !ok {
+		return nil, huma.NewError(http.StatusUnsupportedMediaType, "Only JPEG, PNG and GIF images are accepted")
+	}
+	if format.contentType != file.ContentType {
+		return nil, huma.NewError(http.StatusUnprocessableEntity,
+			fmt.Sprintf("File content is %s, not %s as declared", format.contentType, file.ContentType))
+	}
+
+	name, err := randomName()
+	if err != nil {
+		return nil, err
+	}
+
+	image := localModels.ProductImage{
+		ProductID:    productID,
+		Filename:     file.Filename,
+		ContentType:  format.contentType,
+		Size:         int64(len(content)),
+		StorageKey:   fmt.Sprintf("products/%d/%s%s", productID, name, format.extension),
+		ThumbnailKey: fmt.Sprintf("products/%d/%s_thumb.jpg", productID, name),
+	}
+
+	if err := store.Save(ctx, image.StorageKey, bytes.NewReader(content)); err != nil {
+		return nil, err
+	}
+	if err := store.Save(ctx, image.ThumbnailKey, bytes.NewReader(thumbnail)); err != nil {
+		deleteImageFiles(ctx, store, image)
+		return nil, err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var last int
+		err := tx.Model(&localModels.ProductImage{}).
+			Where("product_id = ?", productID).
+			Select("COALESCE(MAX(position), 0)").
+			Scan(&last).Error
+		if err != nil {
+			return err
+		}
+
+		image.Position = last + 1
+		return tx.Create(&image).Error
+	})
+	if err != nil {
+		deleteImageFiles(ctx, store, image)
+		return nil, err
+	}
+
+	resp.Body = image
+	return resp, nil
+}
+
+// Get the content of a product image or of its thumbnail
+func GetProductImageContent(ctx context.Context, db *gorm.DB, store media.Storage, productID, imageID uint, thumbnail bool) (*dto.ImageContentOutput, error) {
+	image, err := findProductImage(db, productID, imageID)
+	if err != nil {
+		return nil, err
+	}
+
+	key, contentType := image.StorageKey, image.ContentType
+	if thumbnail {
+		key, contentType = image.ThumbnailKey, "image/jpeg"
+	}
+
+	file, err := store.Open(ctx, key)
+	if errors.Is(err, media.ErrNotFound) {
+		return nil, huma.NewError(http.StatusNotFound, "Image not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dto.ImageContentOutput{
+		ContentType:  contentType,
+		CacheControl: "public, max-age=86400",
+		Body:         content,
+	}, nil
+}
+
+// Reorder the images of a product; every image must be listed exactly once
+func ReorderProductImages(ctx context.Context, db *gorm.DB, input *dto.ProductImagesOrderInput) (*dto.ProductImagesOutput, error) {
+	current, err := GetProductImages(ctx, db, input.ProductID)
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[uint]bool, len(current.Body.Images))
+	for _, image := range current.Body.Images {
+		known[image.ID] = true
+	}
+
+	if len(input.Body.ImageIDs) != len(known) {
+		return nil, huma.NewError(http.StatusUnprocessableEntity, "Every image of the product must be listed once")
+	}
+	for _, id := range input.Body.ImageIDs {
+		if !known[id] {
+			return nil, huma.NewError(http.StatusUnprocessableEntity, fmt.Sprintf("Image %d is not an image of this product or is listed twice", id))
+		}
+		delete(known, id)
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for i, id := range input.Body.ImageIDs {
+			if err := tx.Model(&localModels.ProductImage{}).Where("id = ?", id).Update("position", i+1).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return GetProductImages(ctx, db, input.ProductID)
+}
+
+// Delete one image of a product and its stored files
+func DeleteProductImage(ctx context.Context, db *gorm.DB, store media.Storage, productID, imageID uint) error {
+	image, err := findProductImage(db, productID, imageID)
+	if err != nil {
+		return err
+	}
+
+	if err := db.Delete(&image).Error; err != nil {
+		return err
+	}
+
+	deleteImageFiles(ctx, store, image)
+	return nil
+}
+
+// DeleteProductImages removes every image of a product and its stored files
+func DeleteProductImages(ctx context.Context, db *gorm.DB, store media.Storage, productID uint) error {
+	var images []localModels.ProductImage
+	if err := db.Where("product_id = ?", productID).Find(&images).Error; err != nil {
+		return err
+	}
+	if len(images) == 0 {
+		return nil
+	}
+
+	if err := db.Delete(&images).Error; err != nil {
+		return err
+	}
+
+	for _, image := range images {
+		deleteImageFiles(ctx, store, image)
+	}
+	return nil
+}
+
+// deleteImageFiles removes an image and its thumbnail from storage; failures
+// only leave orphan files behind, so they are logged rather than returned
+func deleteImageFiles(ctx context.Context, store media.Storage, image localModels.ProductImage) {
+	for _, key := range []string{image.StorageKey, image.ThumbnailKey} {
+		if err := store.Delete(ctx, key); err != nil {
+			logging.FromContext(ctx).WarnContext(ctx, "Failed to delete media", slog.String("key", key), slog.Any("error", err))
+		}
+	}
+}
+
+// findProduct checks a product exists
+func findProduct(db *gorm.DB, id uint) error {
+	var count int64
+	if err := db.Model(&localModels.Product{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return huma.NewError(http.StatusNotFound, "Product not found")
+	}
+	return nil
+}
+
+// findProductImage loads an image, checking it belongs to the product
+func findProductImage(db *gorm.DB, productID, imageID uint) (localModels.ProductImage, error) {
+	var image localModels.ProductImage
+	err := db.Where("product_id = ?", productID).First(&image, imageID).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return image, huma.NewError(http.StatusNotFound, "Image not found")
+	}
+
+	return image, err
+}
+
+// randomName returns a random file name for stored media
+func randomName() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// ----------------------
+// Register routes with Huma
+// ----------------------
+
+func RegisterImageRoutes(api huma.API, dbConn *gorm.DB, store media.Storage) {
+	huma.Register(api, huma.Operation{
+		OperationID: "get-product-images",
+		Summary:     "Get the images of a product",
+		Method:      http.MethodGet,
+		Path:        "/products/{id}/images",
+		Tags:        []string{"images"},
+	}, func(ctx context.Context, input *struct {
+		Id uint `path:"id"`
+	}) (*dto.ProductImagesOutput, error) {
+		return GetProductImages(ctx, dbConn.WithContext(ctx), input.Id)
+	})
+
+	huma.Register(api, huma.Operation{
+		OperationID:   "upload-product-image",
+		Summary:       "Upload an image for a product",
+		Method:        http.MethodPost,
+		DefaultStatus: http.StatusCreated,
+		Path:          "/products/{id}/images",
+		Tags:          []string{"images"},
+		MaxBodyBytes:  maxImageBytes + 1<<20,
+	}, func(ctx context.Context, input *dto.ProductImageUploadInput) (*dto.ProductImageOutput, error) {
+		return UploadProductImage(ctx, dbConn.WithContext(ctx), store, input.ProductID, input.RawBody.Data().File)
+	})
+
+	huma.Register(api, huma.Operation{
+		OperationID: "reorder-product-images",
+		Summary:     "Change the display order of a product's images",
+		Method:      http.MethodPut,
+		Path:        "/products/{id}/images/order",
+		Tags:        []string{"images"},
+	}, func(ctx context.Context, input *dto.ProductImagesOrderInput) (*dto.ProductImagesOutput, error) {
+		return ReorderProductImages(ctx, dbConn.WithContext(ctx), input)
+	})
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-product-image",
+		Summary:     "Download a product image",
+		Method:      http.MethodGet,
+		Path:        "/products/{id}/images/{imageId}",
+		Tags:        []string{"images"},
+	}, func(ctx context.Context, input *dto.ProductImageInput) (*dto.ImageContentOutput, error) {
+		return GetProductImageContent(ctx, dbConn.WithContext(ctx), store, input.ProductID, input.ImageID, false)
+	})
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-product-image-thumbnail",
+		Summary:     "Download the thumbnail of a product image",
+		Method:      http.MethodGet,
+		Path:        "/products/{id}/images/{imageId}/thumbnail",
+		Tags:        []string{"images"},
+	}, func(ctx context.Context, input *dto.ProductImageInput) (*dto.ImageContentOutput, error) {
+		return GetProductImageContent(ctx, dbConn.WithContext(ctx), store, input.ProductID, input.ImageID, true)
+	})
+
+	huma.Register(api, huma.Operation{
+		OperationID:   "delete-product-image",
+		Summary:       "Delete a product image",
+		Method:        http.MethodDelete,
+		DefaultStatus: http.StatusNoContent,
+		Path:          "/products/{id}/images/{imageId}",
+		Tags:          []string{"images"},
+	}, func(ctx context.Context, input *dto.ProductImageInput) (*struct{}, error) {
+		if err := DeleteProductImage(ctx, dbConn.WithContext(ctx), store, input.ProductID, input.ImageID); err != nil {
+			return nil, err
+		}
+		return &struct{}{}, nil
+	})
+}
@@ -0,0 +1,105 @@
+package operation_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/media"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/operation"
+	"github.com/danielgtaylor/huma/v2"
+)
+
+// uploadedFile is an in-memory multipart file
+type uploadedFile struct {
+	*bytes.Reader
+}
+
+func (uploadedFile) Close() error { return nil }
+
+// pngUpload returns a PNG image uploaded with the declared content type
+func pngUpload(t *testing.T, contentType string) huma.FormFile {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatalf("failed to encode image: %v", err)
+	}
+	return huma.FormFile{
+		File:        uploadedFile{bytes.NewReader(buf.Bytes())},
+		ContentType: contentType,
+		IsSet:       true,
+		Size:        int64(buf.Len()),
+		Filename:    "photo",
+	}
+}
+
+func expectProductExists(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "products" WHERE id = $1`)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+}
+
+func TestUploadProductImageUsesDecodedFormat(t *testing.T) {
+	db, mock := setupMockDB(t)
+	dir := t.TempDir()
+	store, err := media.NewLocalStorage(dir)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+
+	expectProductExists(mock)
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT COALESCE(MAX(position), 0) FROM "product_images" WHERE product_id = $1`)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"coalesce"}).AddRow(0))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "product_images"`)).
+		WithArgs(1, 1, "photo", "image/png", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+	mock.ExpectCommit()
+
+	resp, err := operation.UploadProductImage(context.Background(), db, store, 1, pngUpload(t, "image/png"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if resp.Body.ContentType != "image/png" || !strings.HasSuffix(resp.Body.StorageKey, ".png") {
+		t.Errorf("expected a PNG stored as .png, got %s %s", resp.Body.ContentType, resp.Body.StorageKey)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled sqlmock expectations: %v", err)
+	}
+}
+
+func TestUploadProductImageRejectsMislabelledImage(t *testing.T) {
+	db, mock := setupMockDB(t)
+	dir := t.TempDir()
+	store, err := media.NewLocalStorage(dir)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+
+	expectProductExists(mock)
+
+	_, err = operation.UploadProductImage(context.Background(), db, store, 1, pngUpload(t, "image/jpeg"))
+	var statusErr huma.StatusError
+	if !errors.As(err, &statusErr) || statusErr.GetStatus() != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for a PNG declared as JPEG, got %v", err)
+	}
+
+	if files, _ := filepath.Glob(filepath.Join(dir, "*")); len(files) != 0 {
+		t.Errorf("expected nothing stored, got %v", files)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled sqlmock expectations: %v", err)
+	}
+}
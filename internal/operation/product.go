@@ -3,15 +3,21 @@ package operation
 import (
 	"context"
 	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
 
 	"github.com/PayeTonKawa-EPSI-2025/Common-V2/events"
 	"github.com/PayeTonKawa-EPSI-2025/Common-V2/models"
 	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/dto"
+	localEvents "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/events"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/inventory"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/logging"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/media"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/metrics"
 	localModels "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/models"
 	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/rabbitmq"
 	"github.com/danielgtaylor/huma/v2"
-	amqp "github.com/rabbitmq/amqp091-go"
 	"gorm.io/gorm"
 )
 
@@ -19,12 +25,17 @@ import (
 // Extracted CRUD Functions
 // ----------------------
 
-// Get all orders
-func GetProducts(ctx context.Context, db *gorm.DB) (*dto.ProductsOutput, error) {
+// Get all products, optionally restricted to a lifecycle status ("all" or "" disables the filter)
+func GetProducts(ctx context.Context, db *gorm.DB, status string) (*dto.ProductsOutput, error) {
 	resp := &dto.ProductsOutput{}
 
-	var products []models.Product
-	results := db.Find(&products)
+	query := db
+	if status != "" && status != "all" {
+		query = query.Where("status = ?", status)
+	}
+
+	var products []localModels.Product
+	results := query.Find(&products)
 
 	if results.Error == nil {
 		resp.Body.Products = products
@@ -37,8 +48,10 @@ func GetProducts(ctx context.Context, db *gorm.DB) (*dto.ProductsOutput, error)
 func GetProduct(ctx context.Context, db *gorm.DB, id uint) (*dto.ProductOutput, error) {
 	resp := &dto.ProductOutput{}
 
-	var product models.Product
-	results := db.First(&product, id)
+	var product localModels.Product
+	results := db.Preload("WarehouseStocks").
+		Preload("Images", func(db *gorm.DB) *gorm.DB { return db.Order("position, id") }).
+		First(&product, id)
 
 	if results.Error == nil {
 		resp.Body = product
@@ -65,7 +78,7 @@ func GetProductsByIdOrder(ctx context.Context, db *gorm.DB, id uint) (*dto.Produ
 		productIDs = append(productIDs, op.ProductID)
 	}
 
-	var products []models.Product
+	var products []localModels.Product
 	if len(productIDs) > 0 {
 		if err := db.Where("id IN ?", productIDs).Find(&products).Error; err != nil {
 			return nil, err
@@ -77,36 +90,127 @@ func GetProductsByIdOrder(ctx context.Context, db *gorm.DB, id uint) (*dto.Produ
 	return resp, nil
 }
 
+// Get the customers who bought a product, from the local order mirrors, most
+// recent buyers first
+func GetProductCustomers(ctx context.Context, db *gorm.DB, id uint) (*dto.ProductCustomersOutput, error) {
+	resp := &dto.ProductCustomersOutput{}
+
+	var product localModels.Product
+	if err := db.Select("id").First(&product, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, huma.NewError(http.StatusNotFound, "Product not found")
+		}
+		return nil, err
+	}
+
+	var customers []dto.ProductCustomer
+	results := db.Model(&localModels.Customer{}).
+		Select("customers.*, COUNT(DISTINCT orders.id) AS orders, COUNT(*) AS units, MAX(orders.placed_at) AS last_ordered_at").
+		Joins("JOIN orders ON orders.customer_id = customers.id AND orders.deleted_at IS NULL").
+		Joins("JOIN order_products ON order_products.order_id = orders.id").
+		Where("order_products.product_id = ?", id).
+		Group("customers.id").
+		Order("last_ordered_at DESC NULLS LAST, customers.id").
+		Scan(&customers)
+
+	if results.Error == nil {
+		resp.Body.Customers = customers
+	}
+
+	return resp, results.Error
+}
+
+// Get active products whose stock is at or below their reorder threshold, lowest stock first
+func GetLowStockProducts(ctx context.Context, db *gorm.DB) (*dto.ProductsOutput, error) {
+	resp := &dto.ProductsOutput{}
+
+	var products []localModels.Product
+	results := db.Where("status = ? AND stock <= reorder_threshold", localModels.ProductStatusActive).
+		Order("stock").
+		Find(&products)
+
+	if results.Error == nil {
+		resp.Body.Products = products
+	}
+
+	return resp, results.Error
+}
+
+// publishStockAlert publishes a stock alert if the product's stock crossed its
+// reorder threshold since it was at stockBefore
+func publishStockAlert(ctx context.Context, publisher *rabbitmq.Publisher, stockBefore uint, product localModels.Product) {
+	eventType, ok := localEvents.StockAlertFor(stockBefore, product.Stock, product.ReorderThreshold)
+	if !ok {
+		return
+	}
+	if eventType == localEvents.ProductOutOfStock {
+		metrics.StockOut(product.ID)
+	}
+
+	err := publisher.PublishStockEvent(ctx, eventType, product)
+	if err != nil {
+		// Log the error but don't fail the request
+		// The stock was already changed in the database
+	}
+}
+
+// Move a product to a new lifecycle status, enforcing the allowed transitions
+func ChangeProductStatus(ctx context.Context, db *gorm.DB, publisher *rabbitmq.Publisher, id uint, status localModels.ProductStatus) (*dto.ProductOutput, error) {
+	resp := &dto.ProductOutput{}
+
+	var product localModels.Product
+	results := db.First(&product, id)
+
+	if errors.Is(results.Error, gorm.ErrRecordNotFound) {
+		return nil, huma.NewError(http.StatusNotFound, "Product not found")
+	}
+	if results.Error != nil {
+		return nil, results.Error
+	}
+
+	if !product.Status.CanTransitionTo(status) {
+		return nil, huma.NewError(http.StatusConflict, fmt.Sprintf("Product cannot go from %s to %s", product.Status, status))
+	}
+
+	if err := db.Model(&product).Update("status", status).Error; err != nil {
+		return nil, err
+	}
+	product.Status = status
+	resp.Body = product
+
+	// Publish product updated event
+	err := publisher.PublishProductEvent(ctx, events.ProductUpdated, product.Product)
+	if err != nil {
+		// Log the error but don't fail the request
+		// The status was already changed in the database
+	}
+
+	return resp, nil
+}
+
 // ----------------------
 // Register routes with Huma
 // ----------------------
 
-func RegisterProductsRoutes(api huma.API, dbConn *gorm.DB, ch *amqp.Channel) {
-	// ----------------------
-	// Health endpoint
-	// ----------------------
+func RegisterProductsRoutes(api huma.API, dbConn *gorm.DB, publisher *rabbitmq.Publisher, store media.Storage) {
 	huma.Register(api, huma.Operation{
-		OperationID: "health",
-		Summary:     "Health check endpoint",
+		OperationID: "get-products",
+		Summary:     "Get all products",
 		Method:      http.MethodGet,
-		Path:        "/health",
-		Tags:        []string{"health"},
-	}, func(ctx context.Context, input *struct{}) (*struct {
-		Message string `json:"message"`
-	}, error) {
-		return &struct {
-			Message string `json:"message"`
-		}{Message: "ok"}, nil
+		Path:        "/products",
+		Tags:        []string{"products"},
+	}, func(ctx context.Context, input *dto.ProductsInput) (*dto.ProductsOutput, error) {
+		return GetProducts(ctx, dbConn.WithContext(ctx), input.Status)
 	})
 
 	huma.Register(api, huma.Operation{
-		OperationID: "get-products",
-		Summary:     "Get all products",
+		OperationID: "get-low-stock-products",
+		Summary:     "Get active products at or below their reorder threshold",
 		Method:      http.MethodGet,
-		Path:        "/products",
+		Path:        "/products/low-stock",
 		Tags:        []string{"products"},
 	}, func(ctx context.Context, input *struct{}) (*dto.ProductsOutput, error) {
-		return GetProducts(ctx, dbConn)
+		return GetLowStockProducts(ctx, dbConn.WithContext(ctx))
 	})
 
 	huma.Register(api, huma.Operation{
@@ -118,7 +222,7 @@ func RegisterProductsRoutes(api huma.API, dbConn *gorm.DB, ch *amqp.Channel) {
 	}, func(ctx context.Context, input *struct {
 		Id uint `path:"id"`
 	}) (*dto.ProductOutput, error) {
-		return GetProduct(ctx, dbConn, input.Id)
+		return GetProduct(ctx, dbConn.WithContext(ctx), input.Id)
 	})
 
 	huma.Register(api, huma.Operation{
@@ -129,7 +233,43 @@ func RegisterProductsRoutes(api huma.API, dbConn *gorm.DB, ch *amqp.Channel) {
 		Path:          "/products/{orderId}/orders",
 		Tags:          []string{"products"},
 	}, func(ctx context.Context, input *dto.OrderProductsInput) (*dto.ProductsOutput, error) {
-		return GetProductsByIdOrder(ctx, dbConn, input.OrderID)
+		return GetProductsByIdOrder(ctx, dbConn.WithContext(ctx), input.OrderID)
+	})
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-product-customers",
+		Summary:     "Get the customers who bought a product",
+		Method:      http.MethodGet,
+		Path:        "/products/{id}/customers",
+		Tags:        []string{"products"},
+	}, func(ctx context.Context, input *struct {
+		Id uint `path:"id"`
+	}) (*dto.ProductCustomersOutput, error) {
+		return GetProductCustomers(ctx, dbConn.WithContext(ctx), input.Id)
+	})
+
+	huma.Register(api, huma.Operation{
+		OperationID: "publish-product",
+		Summary:     "Publish a product so it can be sold",
+		Method:      http.MethodPost,
+		Path:        "/products/{id}/publish",
+		Tags:        []string{"products"},
+	}, func(ctx context.Context, input *struct {
+		Id uint `path:"id"`
+	}) (*dto.ProductOutput, error) {
+		return ChangeProductStatus(ctx, dbConn.WithContext(ctx), publisher, input.Id, localModels.ProductStatusActive)
+	})
+
+	huma.Register(api, huma.Operation{
+		OperationID: "discontinue-product",
+		Summary:     "Discontinue a product, keeping it for history",
+		Method:      http.MethodPost,
+		Path:        "/products/{id}/discontinue",
+		Tags:        []string{"products"},
+	}, func(ctx context.Context, input *struct {
+		Id uint `path:"id"`
+	}) (*dto.ProductOutput, error) {
+		return ChangeProductStatus(ctx, dbConn.WithContext(ctx), publisher, input.Id, localModels.ProductStatusDiscontinued)
 	})
 
 	huma.Register(api, huma.Operation{
@@ -142,27 +282,53 @@ func RegisterProductsRoutes(api huma.API, dbConn *gorm.DB, ch *amqp.Channel) {
 	}, func(ctx context.Context, input *dto.ProductCreateInput) (*dto.ProductOutput, error) {
 		resp := &dto.ProductOutput{}
 
-		product := models.Product{
-			Name:    input.Body.Name,
-			Stock:   input.Body.Stock,
-			Details: input.Body.Details,
+		status := input.Body.Status
+		if status == "" {
+			status = localModels.ProductStatusActive
+		}
+
+		product := localModels.Product{
+			Product: models.Product{
+				Name:    input.Body.Name,
+				Details: input.Body.Details,
+			},
+			Status: status,
+		}
+		if input.Body.ReorderThreshold != nil {
+			product.ReorderThreshold = *input.Body.ReorderThreshold
 		}
 
-		results := dbConn.Create(&product)
+		// The initial stock goes into the default warehouse through the ledger
+		err := dbConn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&product).Error; err != nil {
+				return err
+			}
 
-		if results.Error == nil {
-			resp.Body = product
+			if input.Body.Stock == 0 {
+				return nil
+			}
 
-			// Publish product created event
-			err := rabbitmq.PublishProductEvent(ch, events.ProductCreated, product)
+			warehouse, err := inventory.DefaultWarehouse(tx)
 			if err != nil {
-				// Log the error but don't fail the request
-				// The product was already created in the database
-				return resp, nil
+				return err
 			}
+
+			return inventory.Move(tx, &product, warehouse.ID, int(input.Body.Stock), inventory.ReasonAdjustment, fmt.Sprintf("product:%d", product.ID))
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		resp.Body = product
+
+		// Publish product created event
+		err = publisher.PublishProductEvent(ctx, events.ProductCreated, product.Product)
+		if err != nil {
+			// Log the error but don't fail the request
+			// The product was already created in the database
 		}
 
-		return resp, results.Error
+		return resp, nil
 	})
 
 	huma.Register(api, huma.Operation{
@@ -177,8 +343,8 @@ func RegisterProductsRoutes(api huma.API, dbConn *gorm.DB, ch *amqp.Channel) {
 	}) (*dto.ProductOutput, error) {
 		resp := &dto.ProductOutput{}
 
-		var product models.Product
-		results := dbConn.First(&product, input.Id)
+		var product localModels.Product
+		results := dbConn.WithContext(ctx).First(&product, input.Id)
 
 		if errors.Is(results.Error, gorm.ErrRecordNotFound) {
 			return nil, huma.NewError(http.StatusNotFound, "Product not found")
@@ -187,23 +353,68 @@ func RegisterProductsRoutes(api huma.API, dbConn *gorm.DB, ch *amqp.Channel) {
 			return nil, results.Error
 		}
 
-		updates := models.Product{
-			Name:    input.Body.Name,
-			Stock:   input.Body.Stock,
-			Details: input.Body.Details,
+		status := input.Body.Status
+		if status != "" && status != product.Status && !product.Status.CanTransitionTo(status) {
+			return nil, huma.NewError(http.StatusConflict, fmt.Sprintf("Product cannot go from %s to %s", product.Status, status))
 		}
 
-		results = dbConn.Model(&product).Updates(updates)
-		if results.Error != nil {
-			return nil, results.Error
+		updates := localModels.Product{
+			Product: models.Product{
+				Name:    input.Body.Name,
+				Stock:   input.Body.Stock,
+				Details: input.Body.Details,
+			},
+			Status: status,
+		}
+
+		var stockBefore uint
+		err := dbConn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			locked, err := inventory.Lock(tx, product.ID)
+			if err != nil {
+				return err
+			}
+
+			// Fields left empty are kept; stock only changes through the ledger
+			if err := tx.Model(&locked).Omit("stock").Updates(updates).Error; err != nil {
+				return err
+			}
+			// A reorder threshold given is written even when 0, to clear it
+			if input.Body.ReorderThreshold != nil {
+				if err := tx.Model(&locked).Update("reorder_threshold", *input.Body.ReorderThreshold).Error; err != nil {
+					return err
+				}
+			}
+
+			stockBefore = locked.Stock
+			delta := int(input.Body.Stock) - int(locked.Stock)
+			if delta == 0 {
+				return nil
+			}
+
+			// Replacing the total stock adjusts the default warehouse; use the
+			// warehouse endpoints to set other warehouses
+			warehouse, err := inventory.DefaultWarehouse(tx)
+			if err != nil {
+				return err
+			}
+
+			return inventory.Move(tx, &locked, warehouse.ID, delta, inventory.ReasonAdjustment, fmt.Sprintf("product:%d", locked.ID))
+		})
+		if errors.Is(err, inventory.ErrInsufficientStock) {
+			return nil, huma.NewError(http.StatusConflict, "Not enough stock in the default warehouse to lower the total")
+		}
+		if err != nil {
+			return nil, err
 		}
 
 		// Get updated product from DB to ensure all fields are correct
-		dbConn.First(&product, product.ID)
+		dbConn.WithContext(ctx).First(&product, product.ID)
 		resp.Body = product
 
+		publishStockAlert(ctx, publisher, stockBefore, product)
+
 		// Publish product updated event
-		err := rabbitmq.PublishProductEvent(ch, events.ProductUpdated, product)
+		err = publisher.PublishProductEvent(ctx, events.ProductUpdated, product.Product)
 		if err != nil {
 			// Log the error but don't fail the request
 			// The product was already updated in the database
@@ -225,8 +436,8 @@ func RegisterProductsRoutes(api huma.API, dbConn *gorm.DB, ch *amqp.Channel) {
 		resp := &struct{}{}
 
 		// First get the product to have the complete data for the event
-		var product models.Product
-		result := dbConn.First(&product, input.Id)
+		var product localModels.Product
+		result := dbConn.WithContext(ctx).First(&product, input.Id)
 
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			return nil, huma.NewError(http.StatusNotFound, "Product not found")
@@ -236,11 +447,16 @@ func RegisterProductsRoutes(api huma.API, dbConn *gorm.DB, ch *amqp.Channel) {
 			return nil, result.Error
 		}
 
-		results := dbConn.Delete(&product)
+		results := dbConn.WithContext(ctx).Delete(&product)
 
 		if results.Error == nil {
+			// Images are not kept for history, remove them with their files
+			if err := DeleteProductImages(ctx, dbConn.WithContext(ctx), store, product.ID); err != nil {
+				logging.FromContext(ctx).ErrorContext(ctx, "Failed to delete product images", slog.Uint64("product_id", uint64(product.ID)), slog.Any("error", err))
+			}
+
 			// Publish product deleted event
-			err := rabbitmq.PublishProductEvent(ch, events.ProductDeleted, product)
+			err := publisher.PublishProductEvent(ctx, events.ProductDeleted, product.Product)
 			if err != nil {
 				// Log the error but don't fail the request
 				// The product was already deleted from the database
@@ -2,11 +2,19 @@ package operation_test
 
 import (
 	"context"
+	"errors"
+	"log/slog"
+	"net/http"
 	"regexp"
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/config"
+	localModels "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/models"
 	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/operation"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/rabbitmq"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/danielgtaylor/huma/v2/humatest"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
@@ -40,13 +48,16 @@ func TestGetProducts(t *testing.T) {
 		"details_price",
 		"details_description",
 		"details_color",
+		"status",
 	}).
-		AddRow(1, nil, nil, nil, "Product A", 10, 19.99, "High quality product A", "Red").
-		AddRow(2, nil, nil, nil, "Product B", 5, 9.99, "Affordable product B", "Blue")
+		AddRow(1, nil, nil, nil, "Product A", 10, 19.99, "High quality product A", "Red", "active").
+		AddRow(2, nil, nil, nil, "Product B", 5, 9.99, "Affordable product B", "Blue", "active")
 
-	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "products"`)).WillReturnRows(rows)
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "products" WHERE status = $1`)).
+		WithArgs("active").
+		WillReturnRows(rows)
 
-	resp, err := operation.GetProducts(context.Background(), db)
+	resp, err := operation.GetProducts(context.Background(), db, "active")
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -76,3 +87,108 @@ func TestGetProductNotFound(t *testing.T) {
 		t.Fatal("expected error for non-existent product")
 	}
 }
+
+func TestChangeProductStatusRejectsInvalidTransition(t *testing.T) {
+	db, mock := setupMockDB(t)
+
+	rows := sqlmock.NewRows([]string{"id", "name", "stock", "status"}).
+		AddRow(1, "Product A", 10, "active")
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "products" WHERE "products"."id" = $1`)).
+		WithArgs(1, sqlmock.AnyArg()).
+		WillReturnRows(rows)
+
+	_, err := operation.ChangeProductStatus(context.Background(), db, nil, 1, localModels.ProductStatusDraft)
+
+	var statusErr huma.StatusError
+	if !errors.As(err, &statusErr) || statusErr.GetStatus() != http.StatusConflict {
+		t.Fatalf("expected 409 conflict, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled sqlmock expectations: %v", err)
+	}
+}
+
+func TestGetProductCustomers(t *testing.T) {
+	db, mock := setupMockDB(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "id" FROM "products" WHERE "products"."id" = $1`)).
+		WithArgs(1, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	mock.ExpectQuery(`SELECT customers\.\*, COUNT\(DISTINCT orders\.id\) AS orders.*JOIN orders ON orders\.customer_id = customers\.id.*WHERE order_products\.product_id = \$1.*"customers"\."deleted_at" IS NULL GROUP BY "customers"\."id"`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "name", "orders", "units", "last_ordered_at"}).
+			AddRow(4, "jdoe", "John Doe", 2, 3, nil))
+
+	resp, err := operation.GetProductCustomers(context.Background(), db, 1)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(resp.Body.Customers) != 1 {
+		t.Fatalf("expected 1 customer, got %d", len(resp.Body.Customers))
+	}
+
+	customer := resp.Body.Customers[0]
+	if customer.ID != 4 || customer.Username != "jdoe" || customer.Orders != 2 || customer.Units != 3 {
+		t.Errorf("unexpected customer %+v", customer)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled sqlmock expectations: %v", err)
+	}
+}
+
+func TestGetProductCustomersProductNotFound(t *testing.T) {
+	db, mock := setupMockDB(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "id" FROM "products" WHERE "products"."id" = $1`)).
+		WithArgs(1, sqlmock.AnyArg()).
+		WillReturnError(gorm.ErrRecordNotFound)
+
+	_, err := operation.GetProductCustomers(context.Background(), db, 1)
+
+	var statusErr huma.StatusError
+	if !errors.As(err, &statusErr) || statusErr.GetStatus() != http.StatusNotFound {
+		t.Fatalf("expected 404, got %v", err)
+	}
+}
+
+func TestPutProductKeepsOmittedFields(t *testing.T) {
+	db, mock := setupMockDB(t)
+	_, api := humatest.New(t)
+	operation.RegisterProductsRoutes(api, db, rabbitmq.NewPublisher(nil, config.Default().RabbitMQ, slog.Default()), nil)
+
+	productRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "name", "stock", "details_price", "details_color", "status", "reorder_threshold"}).
+			AddRow(1, "Product A", 10, 19.99, "Red", "active", 3)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "products" WHERE "products"."id" = $1`)).
+		WillReturnRows(productRows())
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "products" WHERE "products"."id" = $1 AND "products"."deleted_at" IS NULL ORDER BY "products"."id" LIMIT $2 FOR UPDATE`)).
+		WillReturnRows(productRows())
+	// Only the name is written, the details and threshold left out are kept
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "products" SET "updated_at"=$1,"name"=$2 WHERE "products"."deleted_at" IS NULL AND "id" = $3`)).
+		WithArgs(sqlmock.AnyArg(), "Renamed", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// The threshold given is written even though it is 0
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "products" SET "reorder_threshold"=$1,"updated_at"=$2 WHERE "products"."deleted_at" IS NULL AND "id" = $3`)).
+		WithArgs(0, sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "products" WHERE "products"."id" = $1`)).
+		WillReturnRows(productRows())
+
+	resp := api.Put("/products/1", map[string]any{"name": "Renamed", "stock": 10, "reorderThreshold": 0})
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled sqlmock expectations: %v", err)
+	}
+}
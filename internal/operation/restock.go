@@ -0,0 +1,365 @@
+package operation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/PayeTonKawa-EPSI-2025/Common-V2/events"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/dto"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/inventory"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/logging"
+	localModels "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/models"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/rabbitmq"
+	"github.com/danielgtaylor/huma/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ----------------------
+// Extracted Restock Functions
+// ----------------------
+
+// Get all suppliers
+func GetSuppliers(ctx context.Context, db *gorm.DB) (*dto.SuppliersOutput, error) {
+	resp := &dto.SuppliersOutput{}
+
+	var suppliers []localModels.Supplier
+	results := db.Find(&suppliers)
+
+	if results.Error == nil {
+		resp.Body.Suppliers = suppliers
+	}
+
+	return resp, results.Error
+}
+
+// Get restocks, optionally restricted to a status ("all" or "" disables the filter)
+func GetRestocks(ctx context.Context, db *gorm.DB, status string) (*dto.RestocksOutput, error) {
+	resp := &dto.RestocksOutput{}
+
+	query := db.Preload("Lines")
+	if status != "" && status != "all" {
+		query = query.Where("status = ?", status)
+	}
+
+	var restocks []localModels.Restock
+	results := query.Order("expected_at").Find(&restocks)
+
+	if results.Error == nil {
+		resp.Body.Restocks = restocks
+	}
+
+	return resp, results.Error
+}
+
+// Get a single restock by ID
+func GetRestock(ctx context.Context, db *gorm.DB, id uint) (*dto.RestockOutput, error) {
+	resp := &dto.RestockOutput{}
+
+	var restock localModels.Restock
+	results := db.Preload("Lines").First(&restock, id)
+
+	if results.Error == nil {
+		resp.Body = restock
+		return resp, nil
+	}
+
+	if errors.Is(results.Error, gorm.ErrRecordNotFound) {
+		return nil, huma.NewError(http.StatusNotFound, "Restock not found")
+	}
+
+	return nil, results.Error
+}
+
+// Create an expected restock from a supplier
+func CreateRestock(ctx context.Context, db *gorm.DB, input *dto.RestockCreateInput) (*dto.RestockOutput, error) {
+	resp := &dto.RestockOutput{}
+
+	var supplier localModels.Supplier
+	results := db.First(&supplier, input.Body.SupplierID)
+
+	if errors.Is(results.Error, gorm.ErrRecordNotFound) {
+		return nil, huma.NewError(http.StatusUnprocessableEntity, "Supplier not found")
+	}
+	if results.Error != nil {
+		return nil, results.Error
+	}
+
+	var warehouse localModels.Warehouse
+	var err error
+	if input.Body.WarehouseID != 0 {
+		err = db.First(&warehouse, input.Body.WarehouseID).Error
+	} else {
+		warehouse, err = inventory.DefaultWarehouse(db)
+	}
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, huma.NewError(http.StatusUnprocessableEntity, "Warehouse not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	restock := localModels.Restock{
+		SupplierID:  supplier.ID,
+		WarehouseID: warehouse.ID,
+		Status:      localModels.RestockStatusPending,
+		ExpectedAt:  input.Body.ExpectedAt,
+	}
+
+	for _, line := range input.Body.Lines {
+		var count int64
+		if err := db.Model(&localModels.Product{}).Where("id = ?", line.ProductID).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			return nil, huma.NewError(http.StatusUnprocessableEntity, fmt.Sprintf("Product %d not found", line.ProductID))
+		}
+
+		restock.Lines = append(restock.Lines, localModels.RestockLine{
+			ProductID: line.ProductID,
+			Quantity:  line.Quantity,
+		})
+	}
+
+	if err := db.Create(&restock).Error; err != nil {
+		return nil, err
+	}
+
+	resp.Body = restock
+	return resp, nil
+}
+
+// Receive a pending restock: every line is added to stock through the ledger
+func ReceiveRestock(ctx context.Context, db *gorm.DB, publisher *rabbitmq.Publisher, id uint) (*dto.RestockOutput, error) {
+	resp := &dto.RestockOutput{}
+
+	var restock localModels.Restock
+	var received []localModels.Product
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := lockPendingRestock(tx, &restock, id); err != nil {
+			return err
+		}
+
+		// Merge the lines per product and lock the products in ID order, as
+		// the order handlers do, so concurrent stock changes wait for each
+		// other instead of deadlocking
+		quantities := make(map[uint]uint, len(restock.Lines))
+		for _, line := range restock.Lines {
+			quantities[line.ProductID] += line.Quantity
+		}
+
+		reference := fmt.Sprintf("restock:%d", restock.ID)
+		for _, productID := range slices.Sorted(maps.Keys(quantities)) {
+			product, err := inventory.Lock(tx, productID)
+			if err != nil {
+				return err
+			}
+
+			if err := inventory.Move(tx, &product, restock.WarehouseID, int(quantities[productID]), inventory.ReasonRestock, reference); err != nil {
+				return err
+			}
+
+			received = append(received, product)
+		}
+
+		now := time.Now()
+		restock.Status = localModels.RestockStatusReceived
+		restock.ReceivedAt = &now
+
+		return tx.Model(&restock).Select("status", "received_at").Updates(&restock).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Body = restock
+
+	// Publish one product updated event per product, with its final stock
+	for _, product := range received {
+		err := publisher.PublishProductEvent(ctx, events.ProductUpdated, product.Product)
+		if err != nil {
+			// Don't fail the request, the stock was already updated in the database
+			logging.FromContext(ctx).ErrorContext(ctx, "Failed to publish product updated event",
+				slog.Uint64("product_id", uint64(product.ID)),
+				slog.Any("error", err),
+			)
+		}
+	}
+
+	return resp, nil
+}
+
+// Cancel a pending restock that will not be delivered
+func CancelRestock(ctx context.Context, db *gorm.DB, id uint) (*dto.RestockOutput, error) {
+	resp := &dto.RestockOutput{}
+
+	var restock localModels.Restock
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := lockPendingRestock(tx, &restock, id); err != nil {
+			return err
+		}
+
+		// Without the associations, which would save the loaded lines again
+		restock.Status = localModels.RestockStatusCancelled
+		return tx.Model(&restock).Omit(clause.Associations).Update("status", restock.Status).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Body = restock
+	return resp, nil
+}
+
+// Get the quantities still expected per product from pending restocks
+func GetInboundQuantities(ctx context.Context, db *gorm.DB) (*dto.InboundOutput, error) {
+	resp := &dto.InboundOutput{}
+
+	var inbound []dto.InboundQuantity
+	results := db.Table("restock_lines").
+		Select("restock_lines.product_id, SUM(restock_lines.quantity) AS quantity, MIN(restocks.expected_at) AS next_expected_at").
+		Joins("JOIN restocks ON restocks.id = restock_lines.restock_id").
+		Where("restocks.status = ? AND restocks.deleted_at IS NULL", localModels.RestockStatusPending).
+		Group("restock_lines.product_id").
+		Order("restock_lines.product_id").
+		Scan(&inbound)
+
+	if results.Error == nil {
+		resp.Body.Inbound = inbound
+	}
+
+	return resp, results.Error
+}
+
+// lockPendingRestock loads a restock with its lines, locks it and checks it is still pending
+func lockPendingRestock(tx *gorm.DB, restock *localModels.Restock, id uint) error {
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Lines").First(restock, id).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return huma.NewError(http.StatusNotFound, "Restock not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	if restock.Status != localModels.RestockStatusPending {
+		return huma.NewError(http.StatusConflict, fmt.Sprintf("Restock is already %s", restock.Status))
+	}
+
+	return nil
+}
+
+// ----------------------
+// Register routes with Huma
+// ----------------------
+
+func RegisterRestockRoutes(api huma.API, dbConn *gorm.DB, publisher *rabbitmq.Publisher) {
+	huma.Register(api, huma.Operation{
+		OperationID: "get-suppliers",
+		Summary:     "Get all suppliers",
+		Method:      http.MethodGet,
+		Path:        "/suppliers",
+		Tags:        []string{"restocks"},
+	}, func(ctx context.Context, input *struct{}) (*dto.SuppliersOutput, error) {
+		return GetSuppliers(ctx, dbConn.WithContext(ctx))
+	})
+
+	huma.Register(api, huma.Operation{
+		OperationID:   "create-supplier",
+		Summary:       "Create a supplier",
+		Method:        http.MethodPost,
+		DefaultStatus: http.StatusCreated,
+		Path:          "/suppliers",
+		Tags:          []string{"restocks"},
+	}, func(ctx context.Context, input *dto.SupplierCreateInput) (*dto.SupplierOutput, error) {
+		resp := &dto.SupplierOutput{}
+
+		supplier := localModels.Supplier{
+			Name:  input.Body.Name,
+			Email: input.Body.Email,
+		}
+
+		results := dbConn.WithContext(ctx).Create(&supplier)
+
+		if results.Error == nil {
+			resp.Body = supplier
+		}
+
+		return resp, results.Error
+	})
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-restocks",
+		Summary:     "Get restocks",
+		Method:      http.MethodGet,
+		Path:        "/restocks",
+		Tags:        []string{"restocks"},
+	}, func(ctx context.Context, input *dto.RestocksInput) (*dto.RestocksOutput, error) {
+		return GetRestocks(ctx, dbConn.WithContext(ctx), input.Status)
+	})
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-restock",
+		Summary:     "Get a restock",
+		Method:      http.MethodGet,
+		Path:        "/restocks/{id}",
+		Tags:        []string{"restocks"},
+	}, func(ctx context.Context, input *struct {
+		Id uint `path:"id"`
+	}) (*dto.RestockOutput, error) {
+		return GetRestock(ctx, dbConn.WithContext(ctx), input.Id)
+	})
+
+	huma.Register(api, huma.Operation{
+		OperationID:   "create-restock",
+		Summary:       "Create an expected restock",
+		Method:        http.MethodPost,
+		DefaultStatus: http.StatusCreated,
+		Path:          "/restocks",
+		Tags:          []string{"restocks"},
+	}, func(ctx context.Context, input *dto.RestockCreateInput) (*dto.RestockOutput, error) {
+		return CreateRestock(ctx, dbConn.WithContext(ctx), input)
+	})
+
+	huma.Register(api, huma.Operation{
+		OperationID: "receive-restock",
+		Summary:     "Mark a restock as received and add it to stock",
+		Method:      http.MethodPost,
+		Path:        "/restocks/{id}/receive",
+		Tags:        []string{"restocks"},
+	}, func(ctx context.Context, input *struct {
+		Id uint `path:"id"`
+	}) (*dto.RestockOutput, error) {
+		return ReceiveRestock(ctx, dbConn.WithContext(ctx), publisher, input.Id)
+	})
+
+	huma.Register(api, huma.Operation{
+		OperationID: "cancel-restock",
+		Summary:     "Cancel a pending restock",
+		Method:      http.MethodPost,
+		Path:        "/restocks/{id}/cancel",
+		Tags:        []string{"restocks"},
+	}, func(ctx context.Context, input *struct {
+		Id uint `path:"id"`
+	}) (*dto.RestockOutput, error) {
+		return CancelRestock(ctx, dbConn.WithContext(ctx), input.Id)
+	})
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-inbound-products",
+		Summary:     "Get quantities still expected per product from pending restocks",
+		Method:      http.MethodGet,
+		Path:        "/products/inbound",
+		Tags:        []string{"restocks", "products"},
+	}, func(ctx context.Context, input *struct{}) (*dto.InboundOutput, error) {
+		return GetInboundQuantities(ctx, dbConn.WithContext(ctx))
+	})
+}
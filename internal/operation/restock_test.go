@@ -0,0 +1,148 @@
+package operation_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/config"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/inventory"
+	localModels "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/models"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/operation"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/rabbitmq"
+	"github.com/danielgtaylor/huma/v2"
+)
+
+// expectPendingRestock expects the restock 1 to be locked, pending, with
+// its lines as product ID and quantity pairs
+func expectPendingRestock(mock sqlmock.Sqlmock, lines ...[2]uint) {
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "restocks" WHERE "restocks"."id" = $1`)).
+		WithArgs(1, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "supplier_id", "warehouse_id", "status"}).AddRow(1, 1, 2, "pending"))
+	rows := sqlmock.NewRows([]string{"id", "restock_id", "product_id", "quantity"})
+	for i, line := range lines {
+		rows.AddRow(i+1, 1, line[0], line[1])
+	}
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "restock_lines" WHERE "restock_lines"."restock_id" = $1`)).
+		WithArgs(1).
+		WillReturnRows(rows)
+}
+
+// expectRestockMove expects a product to be locked, then its received
+// quantity added to warehouse 2 through the ledger
+func expectRestockMove(mock sqlmock.Sqlmock, productID uint, stock, quantity int) {
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "products" WHERE "products"."id" = $1`)+`.*FOR UPDATE`).
+		WithArgs(productID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "stock"}).AddRow(productID, "Product", stock))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "warehouse_stocks" ("warehouse_id","product_id","quantity") VALUES ($1,$2,$3) ON CONFLICT ("warehouse_id","product_id") DO UPDATE SET "quantity"=warehouse_stocks.quantity + $4`)).
+		WithArgs(2, productID, quantity, quantity).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "products" SET "stock"=stock + $1 WHERE id = $2`)).
+		WithArgs(quantity, productID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "stock_movements" ("product_id","warehouse_id","delta","reason","reference","created_at") VALUES ($1,$2,$3,$4,$5,$6)`)).
+		WithArgs(productID, 2, quantity, inventory.ReasonRestock, "restock:1", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+}
+
+func TestReceiveRestockAddsStockInProductOrder(t *testing.T) {
+	db, mock := setupMockDB(t)
+	publisher := rabbitmq.NewPublisher(nil, config.Default().RabbitMQ, slog.Default())
+
+	mock.ExpectBegin()
+	// Product 2 is on two lines, received once after product 1
+	expectPendingRestock(mock, [2]uint{2, 5}, [2]uint{1, 3}, [2]uint{2, 4})
+	expectRestockMove(mock, 1, 0, 3)
+	expectRestockMove(mock, 2, 10, 9)
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "restocks" SET "updated_at"=$1,"status"=$2,"received_at"=$3`)).
+		WithArgs(sqlmock.AnyArg(), localModels.RestockStatusReceived, sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	resp, err := operation.ReceiveRestock(context.Background(), db, publisher, 1)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if resp.Body.Status != localModels.RestockStatusReceived || resp.Body.ReceivedAt == nil {
+		t.Errorf("expected a received restock, got %s %v", resp.Body.Status, resp.Body.ReceivedAt)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled sqlmock expectations: %v", err)
+	}
+}
+
+func TestCancelRestock(t *testing.T) {
+	db, mock := setupMockDB(t)
+
+	mock.ExpectBegin()
+	expectPendingRestock(mock, [2]uint{1, 3})
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "restocks" SET "status"=$1`)).
+		WithArgs(localModels.RestockStatusCancelled, sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	resp, err := operation.CancelRestock(context.Background(), db, 1)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if resp.Body.Status != localModels.RestockStatusCancelled {
+		t.Errorf("expected a cancelled restock, got %s", resp.Body.Status)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled sqlmock expectations: %v", err)
+	}
+}
+
+func TestReceiveRestockRejectsReceivedRestock(t *testing.T) {
+	db, mock := setupMockDB(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "restocks" WHERE "restocks"."id" = $1`)).
+		WithArgs(1, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "supplier_id", "status"}).AddRow(1, 1, "received"))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "restock_lines" WHERE "restock_lines"."restock_id" = $1`)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "restock_id", "product_id", "quantity"}).AddRow(1, 1, 1, 10))
+	mock.ExpectRollback()
+
+	_, err := operation.ReceiveRestock(context.Background(), db, nil, 1)
+
+	var statusErr huma.StatusError
+	if !errors.As(err, &statusErr) || statusErr.GetStatus() != http.StatusConflict {
+		t.Fatalf("expected 409 conflict, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled sqlmock expectations: %v", err)
+	}
+}
+
+func TestCancelRestockRejectsCancelledRestock(t *testing.T) {
+	db, mock := setupMockDB(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "restocks" WHERE "restocks"."id" = $1`)).
+		WithArgs(1, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "supplier_id", "status"}).AddRow(1, 1, "cancelled"))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "restock_lines" WHERE "restock_lines"."restock_id" = $1`)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "restock_id", "product_id", "quantity"}))
+	mock.ExpectRollback()
+
+	_, err := operation.CancelRestock(context.Background(), db, 1)
+
+	var statusErr huma.StatusError
+	if !errors.As(err, &statusErr) || statusErr.GetStatus() != http.StatusConflict {
+		t.Fatalf("expected 409 conflict, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled sqlmock expectations: %v", err)
+	}
+}
@@ -0,0 +1,248 @@
+package operation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/PayeTonKawa-EPSI-2025/Common-V2/events"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/dto"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/inventory"
+	localModels "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/models"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/rabbitmq"
+	"github.com/danielgtaylor/huma/v2"
+	"gorm.io/gorm"
+)
+
+// ----------------------
+// Extracted Warehouse Functions
+// ----------------------
+
+// Get all warehouses
+func GetWarehouses(ctx context.Context, db *gorm.DB) (*dto.WarehousesOutput, error) {
+	resp := &dto.WarehousesOutput{}
+
+	var warehouses []localModels.Warehouse
+	results := db.Order("priority, id").Find(&warehouses)
+
+	if results.Error == nil {
+		resp.Body.Warehouses = warehouses
+	}
+
+	return resp, results.Error
+}
+
+// Get the stock levels held in a warehouse
+func GetWarehouseStocks(ctx context.Context, db *gorm.DB, id uint) (*dto.WarehouseStocksOutput, error) {
+	resp := &dto.WarehouseStocksOutput{}
+
+	if err := findWarehouse(db, id, http.StatusNotFound); err != nil {
+		return nil, err
+	}
+
+	var stocks []localModels.WarehouseStock
+	results := db.Where("warehouse_id = ?", id).Order("product_id").Find(&stocks)
+
+	if results.Error == nil {
+		resp.Body.Stocks = stocks
+	}
+
+	return resp, results.Error
+}
+
+// Set the stock level of a product in a warehouse, recording the difference in the ledger
+func SetWarehouseStock(ctx context.Context, db *gorm.DB, publisher *rabbitmq.Publisher, input *dto.WarehouseStockInput) (*dto.WarehouseStockOutput, error) {
+	resp := &dto.WarehouseStockOutput{}
+
+	if err := findWarehouse(db, input.WarehouseID, http.StatusNotFound); err != nil {
+		return nil, err
+	}
+
+	var product localModels.Product
+	var stockBefore uint
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		product, err = inventory.Lock(tx, input.ProductID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return huma.NewError(http.StatusNotFound, "Product not found")
+		}
+		if err != nil {
+			return err
+		}
+
+		var level localModels.WarehouseStock
+		err = tx.Where("warehouse_id = ? AND product_id = ?", input.WarehouseID, input.ProductID).First(&level).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		stockBefore = product.Stock
+		delta := int(input.Body.Quantity) - int(level.Quantity)
+		return inventory.Move(tx, &product, input.WarehouseID, delta, inventory.ReasonAdjustment, fmt.Sprintf("warehouse:%d", input.WarehouseID))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Body = localModels.WarehouseStock{
+		WarehouseID: input.WarehouseID,
+		ProductID:   input.ProductID,
+		Quantity:    input.Body.Quantity,
+	}
+
+	publishStockAlert(ctx, publisher, stockBefore, product)
+
+	// Publish product updated event, the aggregated stock changed
+	err = publisher.PublishProductEvent(ctx, events.ProductUpdated, product.Product)
+	if err != nil {
+		// Log the error but don't fail the request
+		// The stock was already updated in the database
+	}
+
+	return resp, nil
+}
+
+// Get all stock transfers, most recent first
+func GetStockTransfers(ctx context.Context, db *gorm.DB) (*dto.StockTransfersOutput, error) {
+	resp := &dto.StockTransfersOutput{}
+
+	var transfers []localModels.StockTransfer
+	results := db.Order("created_at DESC").Find(&transfers)
+
+	if results.Error == nil {
+		resp.Body.Transfers = transfers
+	}
+
+	return resp, results.Error
+}
+
+// Move stock of a product between two warehouses; the product's total stock is unchanged
+func TransferStock(ctx context.Context, db *gorm.DB, input *dto.StockTransferInput) (*dto.StockTransferOutput, error) {
+	resp := &dto.StockTransferOutput{}
+
+	if input.Body.FromWarehouseID == input.Body.ToWarehouseID {
+		return nil, huma.NewError(http.StatusUnprocessableEntity, "Source and destination warehouses must differ")
+	}
+	for _, id := range []uint{input.Body.FromWarehouseID, input.Body.ToWarehouseID} {
+		if err := findWarehouse(db, id, http.StatusUnprocessableEntity); err != nil {
+			return nil, err
+		}
+	}
+
+	var transfer localModels.StockTransfer
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		transfer, err = inventory.Transfer(tx, input.Body.ProductID, input.Body.FromWarehouseID, input.Body.ToWarehouseID, input.Body.Quantity)
+		return err
+	})
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, huma.NewError(http.StatusUnprocessableEntity, "Product not found")
+	}
+	if errors.Is(err, inventory.ErrInsufficientStock) {
+		return nil, huma.NewError(http.StatusConflict, "Not enough stock in the source warehouse")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Body = transfer
+	return resp, nil
+}
+
+// findWarehouse checks a warehouse exists, reporting it missing with the given status
+func findWarehouse(db *gorm.DB, id uint, missingStatus int) error {
+	var warehouse localModels.Warehouse
+	err := db.First(&warehouse, id).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return huma.NewError(missingStatus, fmt.Sprintf("Warehouse %d not found", id))
+	}
+
+	return err
+}
+
+// ----------------------
+// Register routes with Huma
+// ----------------------
+
+func RegisterWarehouseRoutes(api huma.API, dbConn *gorm.DB, publisher *rabbitmq.Publisher) {
+	huma.Register(api, huma.Operation{
+		OperationID: "get-warehouses",
+		Summary:     "Get all warehouses",
+		Method:      http.MethodGet,
+		Path:        "/warehouses",
+		Tags:        []string{"warehouses"},
+	}, func(ctx context.Context, input *struct{}) (*dto.WarehousesOutput, error) {
+		return GetWarehouses(ctx, dbConn.WithContext(ctx))
+	})
+
+	huma.Register(api, huma.Operation{
+		OperationID:   "create-warehouse",
+		Summary:       "Create a warehouse",
+		Method:        http.MethodPost,
+		DefaultStatus: http.StatusCreated,
+		Path:          "/warehouses",
+		Tags:          []string{"warehouses"},
+	}, func(ctx context.Context, input *dto.WarehouseCreateInput) (*dto.WarehouseOutput, error) {
+		resp := &dto.WarehouseOutput{}
+
+		warehouse := localModels.Warehouse{
+			Code:     input.Body.Code,
+			Name:     input.Body.Name,
+			Priority: input.Body.Priority,
+		}
+
+		results := dbConn.WithContext(ctx).Create(&warehouse)
+
+		if results.Error == nil {
+			resp.Body = warehouse
+		}
+
+		return resp, results.Error
+	})
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-warehouse-stocks",
+		Summary:     "Get the stock levels held in a warehouse",
+		Method:      http.MethodGet,
+		Path:        "/warehouses/{id}/stocks",
+		Tags:        []string{"warehouses"},
+	}, func(ctx context.Context, input *struct {
+		Id uint `path:"id"`
+	}) (*dto.WarehouseStocksOutput, error) {
+		return GetWarehouseStocks(ctx, dbConn.WithContext(ctx), input.Id)
+	})
+
+	huma.Register(api, huma.Operation{
+		OperationID: "put-warehouse-stock",
+		Summary:     "Set the stock level of a product in a warehouse",
+		Method:      http.MethodPut,
+		Path:        "/warehouses/{id}/stocks/{productId}",
+		Tags:        []string{"warehouses"},
+	}, func(ctx context.Context, input *dto.WarehouseStockInput) (*dto.WarehouseStockOutput, error) {
+		return SetWarehouseStock(ctx, dbConn.WithContext(ctx), publisher, input)
+	})
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-stock-transfers",
+		Summary:     "Get all stock transfers between warehouses",
+		Method:      http.MethodGet,
+		Path:        "/warehouses/transfers",
+		Tags:        []string{"warehouses"},
+	}, func(ctx context.Context, input *struct{}) (*dto.StockTransfersOutput, error) {
+		return GetStockTransfers(ctx, dbConn.WithContext(ctx))
+	})
+
+	huma.Register(api, huma.Operation{
+		OperationID:   "create-stock-transfer",
+		Summary:       "Transfer stock between warehouses",
+		Method:        http.MethodPost,
+		DefaultStatus: http.StatusCreated,
+		Path:          "/warehouses/transfers",
+		Tags:          []string{"warehouses"},
+	}, func(ctx context.Context, input *dto.StockTransferInput) (*dto.StockTransferOutput, error) {
+		return TransferStock(ctx, dbConn.WithContext(ctx), input)
+	})
+}
@@ -0,0 +1,172 @@
+package rabbitmq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/config"
+	localEvents "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/events"
+	localModels "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/models"
+	"gorm.io/gorm"
+)
+
+// Directions of the archived messages
+const (
+	ArchiveConsumed  = "consumed"
+	ArchivePublished = "published"
+)
+
+// Outcomes of the archived messages
+const (
+	OutcomeHandled   = "handled"
+	OutcomeFailed    = "failed"
+	OutcomeRejected  = "rejected"
+	OutcomePublished = "published"
+)
+
+// failedOutcomes are kept for the failure retention
+var failedOutcomes = []string{OutcomeFailed, OutcomeRejected}
+
+// EventArchive records the consumed and published messages in the
+// archived_events table
+type EventArchive struct {
+	db     *gorm.DB
+	cfg    config.Archive
+	logger *slog.Logger
+}
+
+// NewEventArchive creates an archive on the database
+func NewEventArchive(db *gorm.DB, cfg config.Archive, logger *slog.Logger) *EventArchive {
+	return &EventArchive{db: db, cfg: cfg, logger: logger}
+}
+
+// Record archives a message with the outcome of its handling or publishing.
+// Failing to archive is only logged, it never fails the message.
+func (a *EventArchive) Record(ctx context.Context, direction string, delivery localEvents.Delivery, err error, duration time.Duration) {
+	entry := localModels.ArchivedEvent{
+		Direction:     direction,
+		RoutingKey:    delivery.RoutingKey,
+		EntityID:      localEvents.EntityID(delivery.RoutingKey, delivery.Body),
+		MessageID:     delivery.MessageID,
+		CorrelationID: delivery.CorrelationID,
+		Body:          delivery.Body,
+		Outcome:       outcome(direction, err),
+		DurationMs:    duration.Milliseconds(),
+		Timestamp:     delivery.Timestamp,
+		RecordedAt:    time.Now(),
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	if len(delivery.Headers) > 0 {
+		// Headers of types JSON cannot encode are left out
+		entry.Headers, _ = json.Marshal(delivery.Headers)
+	}
+	// Keep invalid bodies as a JSON string
+	if !json.Valid(entry.Body) {
+		entry.Body, _ = json.Marshal(string(delivery.Body))
+	}
+
+	// Archive even when the handler timed out or shutdown cancelled it
+	ctx = context.WithoutCancel(ctx)
+	if err := a.db.WithContext(ctx).Create(&entry).Error; err != nil {
+		a.logger.ErrorContext(ctx, "Failed to archive message",
+			slog.String("routing_key", delivery.RoutingKey),
+			slog.String("message_id", delivery.MessageID),
+			slog.Any("error", err),
+		)
+	}
+}
+
+// outcome classifies the result of handling or publishing a message
+func outcome(direction string, err error) string {
+	var panicErr *PanicError
+	switch {
+	case err == nil && direction == ArchivePublished:
+		return OutcomePublished
+	case err == nil:
+		return OutcomeHandled
+	case errors.Is(err, localEvents.ErrInvalidEvent), errors.As(err, &panicErr):
+		return OutcomeRejected
+	default:
+		return OutcomeFailed
+	}
+}
+
+// Prune deletes the messages past their retention and the processed message
+// IDs past theirs, returning how many rows
+func (a *EventArchive) Prune(ctx context.Context, now time.Time) (int64, error) {
+	var deleted int64
+	prune := func(retention time.Duration, condition string) error {
+		if retention <= 0 {
+			return nil
+		}
+		result := a.db.WithContext(ctx).
+			Where("recorded_at < ?", now.Add(-retention)).
+			Where(condition, failedOutcomes).
+			Delete(&localModels.ArchivedEvent{})
+		deleted += result.RowsAffected
+		return result.Error
+	}
+
+	if err := prune(a.cfg.Retention, "outcome NOT IN ?"); err != nil {
+		return deleted, err
+	}
+	if err := prune(a.cfg.FailureRetention, "outcome IN ?"); err != nil {
+		return deleted, err
+	}
+
+	if a.cfg.ProcessedRetention <= 0 {
+		return deleted, nil
+	}
+	result := a.db.WithContext(ctx).
+		Where("processed_at < ?", now.Add(-a.cfg.ProcessedRetention)).
+		Delete(&localModels.ProcessedMessage{})
+	deleted += result.RowsAffected
+	return deleted, result.Error
+}
+
+// RunRetention prunes the archive and the processed message IDs every prune
+// interval until ctx is done
+func (a *EventArchive) RunRetention(ctx context.Context) {
+	ticker := time.NewTicker(a.cfg.PruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		deleted, err := a.Prune(ctx, time.Now())
+		if err != nil {
+			a.logger.ErrorContext(ctx, "Failed to prune the event archive and processed messages", slog.Any("error", err))
+			continue
+		}
+		if deleted > 0 {
+			a.logger.InfoContext(ctx, "Pruned the event archive and processed messages", slog.Int64("deleted", deleted))
+		}
+	}
+}
+
+// Archive records every consumed message with the outcome of its handling.
+// Messages published with the given origin are left out, as the publisher
+// archived them already.
+func Archive(archive *EventArchive, origin string) Middleware {
+	return func(next EventHandler) EventHandler {
+		return func(ctx context.Context, delivery localEvents.Delivery) error {
+			if origin != "" && delivery.Headers[OriginHeader] == origin {
+				return next(ctx, delivery)
+			}
+
+			start := time.Now()
+			err := next(ctx, delivery)
+			archive.Record(ctx, ArchiveConsumed, delivery, err, time.Since(start))
+			return err
+		}
+	}
+}
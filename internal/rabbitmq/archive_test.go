@@ -0,0 +1,142 @@
+package rabbitmq_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/config"
+	localEvents "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/events"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/rabbitmq"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func newMockArchive(t *testing.T, cfg config.Archive) (*rabbitmq.EventArchive, sqlmock.Sqlmock) {
+	dbMock, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{Conn: dbMock}), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open gorm DB: %v", err)
+	}
+	return rabbitmq.NewEventArchive(gormDB, cfg, slog.New(slog.NewTextHandler(io.Discard, nil))), mock
+}
+
+func TestArchiveOutcomes(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		outcome string
+	}{
+		{"handled", nil, rabbitmq.OutcomeHandled},
+		{"failed", errors.New("database down"), rabbitmq.OutcomeFailed},
+		{"invalid", fmt.Errorf("order.created: %w", localEvents.ErrInvalidEvent), rabbitmq.OutcomeRejected},
+		{"panicked", &rabbitmq.PanicError{Value: "boom"}, rabbitmq.OutcomeRejected},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			archive, mock := newMockArchive(t, config.Archive{})
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "archived_events"`)).
+				WithArgs(rabbitmq.ArchiveConsumed, "order.created", "42", "m1", "", []byte(`{"order":{"orderId":42}}`),
+					tt.outcome, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+			mock.ExpectCommit()
+
+			handler := rabbitmq.Archive(archive, "/products")(func(ctx context.Context, delivery localEvents.Delivery) error {
+				return tt.err
+			})
+			err := handler(context.Background(), localEvents.Delivery{
+				RoutingKey: "order.created",
+				MessageID:  "m1",
+				Body:       []byte(`{"order":{"orderId":42}}`),
+			})
+			if !errors.Is(err, tt.err) {
+				t.Errorf("expected the handler error, got %v", err)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unfulfilled sqlmock expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestArchiveSkipsOwnEvents(t *testing.T) {
+	// Published events are archived by the publisher, nothing is written here
+	archive, mock := newMockArchive(t, config.Archive{})
+
+	handled := false
+	handler := rabbitmq.Archive(archive, "/products")(func(ctx context.Context, delivery localEvents.Delivery) error {
+		handled = true
+		return nil
+	})
+	err := handler(context.Background(), localEvents.Delivery{
+		RoutingKey: "product.updated",
+		MessageID:  "m1",
+		Headers:    map[string]any{rabbitmq.OriginHeader: "/products"},
+		Body:       []byte(`{"product":{"ID":7}}`),
+	})
+	if err != nil || !handled {
+		t.Errorf("expected the message to be handled, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled sqlmock expectations: %v", err)
+	}
+}
+
+func TestArchivePrune(t *testing.T) {
+	archive, mock := newMockArchive(t, config.Archive{Retention: time.Hour, FailureRetention: 24 * time.Hour})
+	now := time.Date(2025, 3, 2, 12, 0, 0, 0, time.UTC)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "archived_events" WHERE recorded_at < $1 AND outcome NOT IN ($2,$3)`)).
+		WithArgs(now.Add(-time.Hour), rabbitmq.OutcomeFailed, rabbitmq.OutcomeRejected).
+		WillReturnResult(sqlmock.NewResult(0, 5))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "archived_events" WHERE recorded_at < $1 AND outcome IN ($2,$3)`)).
+		WithArgs(now.Add(-24*time.Hour), rabbitmq.OutcomeFailed, rabbitmq.OutcomeRejected).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	deleted, err := archive.Prune(context.Background(), now)
+	if err != nil || deleted != 7 {
+		t.Errorf("expected 7 deleted messages, got %d, %v", deleted, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled sqlmock expectations: %v", err)
+	}
+}
+
+func TestArchivePruneProcessedMessages(t *testing.T) {
+	archive, mock := newMockArchive(t, config.Archive{ProcessedRetention: 7 * 24 * time.Hour})
+	now := time.Date(2025, 3, 2, 12, 0, 0, 0, time.UTC)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "processed_messages" WHERE processed_at < $1`)).
+		WithArgs(now.Add(-7 * 24 * time.Hour)).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectCommit()
+
+	deleted, err := archive.Prune(context.Background(), now)
+	if err != nil || deleted != 3 {
+		t.Errorf("expected 3 deleted message IDs, got %d, %v", deleted, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled sqlmock expectations: %v", err)
+	}
+}
@@ -0,0 +1,157 @@
+package rabbitmq
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	localEvents "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/events"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// CloudEvents modes of the publisher, following the AMQP protocol binding
+// of CloudEvents 1.0. Consumed messages are decoded in either mode.
+const (
+	// CloudEventsOff publishes the plain JSON events
+	CloudEventsOff = ""
+	// CloudEventsBinary keeps the event as body and moves the attributes to
+	// cloudEvents_* headers
+	CloudEventsBinary = "binary"
+	// CloudEventsStructured wraps the event in an application/cloudevents+json body
+	CloudEventsStructured = "structured"
+)
+
+const (
+	cloudEventsSpecVersion = "1.0"
+	cloudEventsContentType = "application/cloudevents+json"
+	// cloudEventsPrefix prefixes the attribute headers in binary mode; the
+	// older "cloudEvents:" prefix is accepted too
+	cloudEventsPrefix       = "cloudEvents_"
+	legacyCloudEventsPrefix = "cloudEvents:"
+)
+
+// cloudEvent is a CloudEvent in structured mode. The data is the event
+// published in plain mode.
+type cloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            *time.Time      `json:"time,omitempty"`
+	DataContentType string          `json:"datacontenttype,omitempty"`
+	CorrelationID   string          `json:"correlationid,omitempty"`
+	Data            json.RawMessage `json:"data,omitempty"`
+	DataBase64      string          `json:"data_base64,omitempty"`
+}
+
+// encodeCloudEvent turns a plain JSON publishing into a CloudEvent in the
+// given mode
+func encodeCloudEvent(msg *amqp.Publishing, mode, source, eventType, subject string) error {
+	switch mode {
+	case CloudEventsOff:
+		return nil
+
+	case CloudEventsBinary:
+		msg.Headers[cloudEventsPrefix+"specversion"] = cloudEventsSpecVersion
+		msg.Headers[cloudEventsPrefix+"id"] = msg.MessageId
+		msg.Headers[cloudEventsPrefix+"source"] = source
+		msg.Headers[cloudEventsPrefix+"type"] = eventType
+		msg.Headers[cloudEventsPrefix+"time"] = msg.Timestamp.UTC().Format(time.RFC3339Nano)
+		if subject != "" {
+			msg.Headers[cloudEventsPrefix+"subject"] = subject
+		}
+		if msg.CorrelationId != "" {
+			msg.Headers[cloudEventsPrefix+"correlationid"] = msg.CorrelationId
+		}
+		return nil
+
+	case CloudEventsStructured:
+		timestamp := msg.Timestamp.UTC()
+		body, err := json.Marshal(cloudEvent{
+			SpecVersion:     cloudEventsSpecVersion,
+			ID:              msg.MessageId,
+			Source:          source,
+			Type:            eventType,
+			Subject:         subject,
+			Time:            &timestamp,
+			DataContentType: msg.ContentType,
+			CorrelationID:   msg.CorrelationId,
+			Data:            msg.Body,
+		})
+		if err != nil {
+			return err
+		}
+		msg.ContentType = cloudEventsContentType
+		msg.Body = body
+		return nil
+	}
+	return fmt.Errorf("unknown CloudEvents mode %q", mode)
+}
+
+// decodeCloudEvent unwraps a CloudEvent received in structured or binary
+// mode, so handlers get the event data as body whatever the publisher mode.
+// Other messages are left as they are.
+func decodeCloudEvent(delivery *localEvents.Delivery, contentType string) error {
+	if strings.HasPrefix(contentType, cloudEventsContentType) {
+		var event cloudEvent
+		if err := json.Unmarshal(delivery.Body, &event); err != nil {
+			return fmt.Errorf("%w: structured CloudEvent: %v", localEvents.ErrInvalidEvent, err)
+		}
+		if event.SpecVersion != cloudEventsSpecVersion || event.ID == "" || event.Source == "" || event.Type == "" {
+			return fmt.Errorf("%w: structured CloudEvent requires specversion 1.0, id, source and type", localEvents.ErrInvalidEvent)
+		}
+
+		delivery.MessageID = event.ID
+		if event.Time != nil {
+			delivery.Timestamp = *event.Time
+		}
+		if event.CorrelationID != "" {
+			delivery.CorrelationID = event.CorrelationID
+		}
+		delivery.Body = event.Data
+		if event.DataBase64 != "" {
+			data, err := base64.StdEncoding.DecodeString(event.DataBase64)
+			if err != nil {
+				return fmt.Errorf("%w: CloudEvent data_base64: %v", localEvents.ErrInvalidEvent, err)
+			}
+			delivery.Body = data
+		}
+		return nil
+	}
+
+	attribute := func(name string) string {
+		for _, prefix := range []string{cloudEventsPrefix, legacyCloudEventsPrefix} {
+			if value, ok := delivery.Headers[prefix+name].(string); ok {
+				return value
+			}
+		}
+		return ""
+	}
+
+	// Messages without any attribute header are plain events
+	if !slices.ContainsFunc(slices.Collect(maps.Keys(delivery.Headers)), isCloudEventsHeader) {
+		return nil
+	}
+	if attribute("specversion") != cloudEventsSpecVersion || attribute("id") == "" || attribute("source") == "" || attribute("type") == "" {
+		return fmt.Errorf("%w: binary CloudEvent requires specversion 1.0, id, source and type", localEvents.ErrInvalidEvent)
+	}
+
+	delivery.MessageID = attribute("id")
+	if t, err := time.Parse(time.RFC3339Nano, attribute("time")); err == nil {
+		delivery.Timestamp = t
+	}
+	if id := attribute("correlationid"); id != "" {
+		delivery.CorrelationID = id
+	}
+	return nil
+}
+
+// isCloudEventsHeader reports whether a header is a CloudEvents attribute
+func isCloudEventsHeader(name string) bool {
+	return strings.HasPrefix(name, cloudEventsPrefix) || strings.HasPrefix(name, legacyCloudEventsPrefix)
+}
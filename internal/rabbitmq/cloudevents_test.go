@@ -0,0 +1,171 @@
+package rabbitmq_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	localEvents "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/events"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/rabbitmq"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const productEvent = `{"type":"product.updated","product":{"ID":7}}`
+
+func newPublishing() amqp.Publishing {
+	return amqp.Publishing{
+		Headers:       amqp.Table{},
+		ContentType:   "application/json",
+		MessageId:     "m1",
+		CorrelationId: "c1",
+		Timestamp:     time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC),
+		Body:          []byte(productEvent),
+	}
+}
+
+// received turns a publishing into the delivery of a consumer
+func received(msg amqp.Publishing) amqp.Delivery {
+	return amqp.Delivery{
+		Headers:     msg.Headers,
+		ContentType: msg.ContentType,
+		RoutingKey:  "product.updated",
+		Body:        msg.Body,
+	}
+}
+
+func assertRoundTrip(t *testing.T, delivery localEvents.Delivery, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if string(delivery.Body) != productEvent {
+		t.Errorf("expected the event as body, got %s", delivery.Body)
+	}
+	if delivery.MessageID != "m1" || delivery.CorrelationID != "c1" {
+		t.Errorf("expected the message and correlation IDs, got %q and %q", delivery.MessageID, delivery.CorrelationID)
+	}
+	if !delivery.Timestamp.Equal(time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the event time, got %s", delivery.Timestamp)
+	}
+}
+
+func TestCloudEventsBinaryRoundTrip(t *testing.T) {
+	msg := newPublishing()
+	if err := rabbitmq.EncodeCloudEvent(&msg, rabbitmq.CloudEventsBinary, "/products", "product.updated", "product/7"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if msg.ContentType != "application/json" || string(msg.Body) != productEvent {
+		t.Errorf("expected the event to stay the body, got %s %s", msg.ContentType, msg.Body)
+	}
+	for name, want := range map[string]string{
+		"cloudEvents_specversion": "1.0",
+		"cloudEvents_id":          "m1",
+		"cloudEvents_source":      "/products",
+		"cloudEvents_type":        "product.updated",
+		"cloudEvents_subject":     "product/7",
+	} {
+		if msg.Headers[name] != want {
+			t.Errorf("expected header %s %q, got %v", name, want, msg.Headers[name])
+		}
+	}
+
+	delivery, err := rabbitmq.DecodeDelivery(received(msg))
+	assertRoundTrip(t, delivery, err)
+}
+
+func TestCloudEventsBinaryLegacyPrefix(t *testing.T) {
+	d := received(newPublishing())
+	d.Headers = amqp.Table{
+		"cloudEvents:specversion":   "1.0",
+		"cloudEvents:id":            "m1",
+		"cloudEvents:source":        "/products",
+		"cloudEvents:type":          "product.updated",
+		"cloudEvents:time":          "2025-03-01T10:00:00Z",
+		"cloudEvents:correlationid": "c1",
+	}
+
+	delivery, err := rabbitmq.DecodeDelivery(d)
+	assertRoundTrip(t, delivery, err)
+}
+
+func TestCloudEventsStructuredRoundTrip(t *testing.T) {
+	msg := newPublishing()
+	if err := rabbitmq.EncodeCloudEvent(&msg, rabbitmq.CloudEventsStructured, "/products", "product.updated", ""); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if msg.ContentType != "application/cloudevents+json" {
+		t.Errorf("expected a structured CloudEvent, got %s", msg.ContentType)
+	}
+	var event map[string]any
+	if err := json.Unmarshal(msg.Body, &event); err != nil {
+		t.Fatalf("expected a JSON body, got %v", err)
+	}
+	if event["specversion"] != "1.0" || event["id"] != "m1" || event["datacontenttype"] != "application/json" {
+		t.Errorf("unexpected CloudEvent %s", msg.Body)
+	}
+
+	delivery, err := rabbitmq.DecodeDelivery(received(msg))
+	assertRoundTrip(t, delivery, err)
+}
+
+func TestCloudEventsStructuredDataBase64(t *testing.T) {
+	msg := newPublishing()
+	msg.ContentType = "application/cloudevents+json; charset=utf-8"
+	msg.Body, _ = json.Marshal(map[string]any{
+		"specversion":   "1.0",
+		"id":            "m1",
+		"source":        "/products",
+		"type":          "product.updated",
+		"time":          "2025-03-01T10:00:00Z",
+		"correlationid": "c1",
+		"data_base64":   base64.StdEncoding.EncodeToString([]byte(productEvent)),
+	})
+
+	delivery, err := rabbitmq.DecodeDelivery(received(msg))
+	assertRoundTrip(t, delivery, err)
+}
+
+func TestCloudEventsRejectsMissingAttributes(t *testing.T) {
+	for _, missing := range []string{"id", "source", "specversion"} {
+		t.Run("binary without "+missing, func(t *testing.T) {
+			msg := newPublishing()
+			if err := rabbitmq.EncodeCloudEvent(&msg, rabbitmq.CloudEventsBinary, "/products", "product.updated", ""); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			delete(msg.Headers, "cloudEvents_"+missing)
+
+			if _, err := rabbitmq.DecodeDelivery(received(msg)); !errors.Is(err, localEvents.ErrInvalidEvent) {
+				t.Errorf("expected an invalid event, got %v", err)
+			}
+		})
+
+		t.Run("structured without "+missing, func(t *testing.T) {
+			msg := newPublishing()
+			if err := rabbitmq.EncodeCloudEvent(&msg, rabbitmq.CloudEventsStructured, "/products", "product.updated", ""); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			var event map[string]any
+			_ = json.Unmarshal(msg.Body, &event)
+			delete(event, missing)
+			msg.Body, _ = json.Marshal(event)
+
+			if _, err := rabbitmq.DecodeDelivery(received(msg)); !errors.Is(err, localEvents.ErrInvalidEvent) {
+				t.Errorf("expected an invalid event, got %v", err)
+			}
+		})
+	}
+}
+
+func TestPlainMessagesAreNotCloudEvents(t *testing.T) {
+	msg := newPublishing()
+	msg.Headers["x-correlation-id"] = "c1"
+
+	delivery, err := rabbitmq.DecodeDelivery(received(msg))
+	if err != nil || string(delivery.Body) != productEvent {
+		t.Errorf("expected the plain message as it is, got %s, %v", delivery.Body, err)
+	}
+}
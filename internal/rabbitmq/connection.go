@@ -1,27 +1,29 @@
 package rabbitmq
 
 import (
-	"log"
-	"os"
+	"context"
+	"errors"
+	"fmt"
 
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/config"
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
-func Connect() (*amqp.Connection, *amqp.Channel) {
-	dsn := os.Getenv("RABBIT_DSN")
-
-	conn, err := amqp.Dial(dsn)
+// Connect opens a channel on RabbitMQ and declares the events exchange
+func Connect(cfg config.RabbitMQ) (*amqp.Connection, *amqp.Channel, error) {
+	conn, err := amqp.Dial(cfg.DSN)
 	if err != nil {
-		log.Fatalf("Erreur de connexion à RabbitMQ : %v", err)
+		return nil, nil, fmt.Errorf("connecting to RabbitMQ: %w", err)
 	}
 
 	ch, err := conn.Channel()
 	if err != nil {
-		log.Fatalf("Erreur ouverture channel : %v", err)
+		conn.Close()
+		return nil, nil, fmt.Errorf("opening RabbitMQ channel: %w", err)
 	}
 
 	err = ch.ExchangeDeclare(
-		"events",
+		cfg.Exchange,
 		"topic",
 		true,
 		false,
@@ -30,8 +32,69 @@ func Connect() (*amqp.Connection, *amqp.Channel) {
 		nil,
 	)
 	if err != nil {
-		log.Fatalf("Erreur déclaration exchange : %v", err)
+		conn.Close()
+		return nil, nil, fmt.Errorf("declaring events exchange: %w", err)
+	}
+
+	if cfg.DeadLetterExchange != "" {
+		if err := declareDeadLetter(ch, cfg.DeadLetterExchange); err != nil {
+			conn.Close()
+			return nil, nil, fmt.Errorf("declaring dead letter exchange: %w", err)
+		}
+	}
+
+	return conn, ch, nil
+}
+
+// declareDeadLetter declares the dead letter exchange and the durable queue
+// keeping its messages for inspection
+func declareDeadLetter(ch *amqp.Channel, name string) error {
+	if err := ch.ExchangeDeclare(name, "fanout", true, false, false, false, nil); err != nil {
+		return err
 	}
+	if _, err := ch.QueueDeclare(name, true, false, false, false, nil); err != nil {
+		return err
+	}
+	return ch.QueueBind(name, "", name, false, nil)
+}
 
-	return conn, ch
+// HealthCheck reports the connection, channel and consumer as down once
+// any of them is closed
+func HealthCheck(conn *amqp.Connection, ch *amqp.Channel, router *EventRouter) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		switch {
+		case conn == nil || conn.IsClosed():
+			return errors.New("connection closed")
+		case ch == nil || ch.IsClosed():
+			return errors.New("channel closed")
+		case router != nil && !router.Consuming():
+			return errors.New("consumer not running")
+		}
+		return nil
+	}
+}
+
+// BacklogCheck reports the consumed queue as down when more than
+// maxMessages wait in it, the consumer falling behind. It inspects the queue
+// on a channel of its own, as a failed inspection closes the channel.
+func BacklogCheck(conn *amqp.Connection, queue string, maxMessages int) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		if conn == nil || conn.IsClosed() {
+			return errors.New("connection closed")
+		}
+		ch, err := conn.Channel()
+		if err != nil {
+			return fmt.Errorf("opening RabbitMQ channel: %w", err)
+		}
+		defer ch.Close()
+
+		q, err := ch.QueueDeclarePassive(queue, false, false, false, false, nil)
+		if err != nil {
+			return fmt.Errorf("inspecting queue %s: %w", queue, err)
+		}
+		if q.Messages > maxMessages {
+			return fmt.Errorf("%d messages waiting in queue %s, more than %d", q.Messages, queue, maxMessages)
+		}
+		return nil
+	}
 }
@@ -1,140 +1,419 @@
 package rabbitmq
 
 import (
-	"log"
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"runtime/debug"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/config"
+	localEvents "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/events"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/logging"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/metrics"
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
-// EventHandler is a function type that processes RabbitMQ events
-type EventHandler func(body []byte) error
+// EventHandler is a function type that processes RabbitMQ events. The context
+// carries the correlation ID of the message and is cancelled when the handler
+// times out or the consumer is stopped.
+type EventHandler func(ctx context.Context, delivery localEvents.Delivery) error
 
-// EventRouter routes events to specific handlers based on routing keys
+// KeyFunc returns the entity a message is about, e.g. "order:42". Messages
+// with the same key are handled one at a time in delivery order.
+type KeyFunc func(delivery localEvents.Delivery) string
+
+// route is a registered handler with its settings
+type route struct {
+	handler EventHandler
+	timeout time.Duration
+	key     KeyFunc
+	// idempotent records the handled messages in the idempotency store
+	idempotent bool
+}
+
+// HandlerOption customizes the registration of a handler
+type HandlerOption func(*route)
+
+// WithTimeout overrides the router timeout for one handler, 0 disables it
+func WithTimeout(timeout time.Duration) HandlerOption {
+	return func(r *route) {
+		r.timeout = timeout
+	}
+}
+
+// WithKey sets how the messages of a handler are partitioned between workers.
+// Without it, messages are ordered per routing key. When several handlers
+// share a pattern, the key of the first one registered with a key is used.
+func WithKey(key KeyFunc) HandlerOption {
+	return func(r *route) {
+		r.key = key
+	}
+}
+
+// WithoutIdempotency leaves the messages of a handler out of the idempotency
+// store, for handlers without side effects like the debug catch-all. Messages
+// also matching a handler without it are still recorded.
+func WithoutIdempotency() HandlerOption {
+	return func(r *route) {
+		r.idempotent = false
+	}
+}
+
+// EventRouter routes events to handlers registered on AMQP topic patterns.
+// A message goes to the handlers of the pattern equal to its routing key, or
+// else of the most specific pattern matching it.
 type EventRouter struct {
-	handlers map[string]EventHandler
+	handlers   map[string][]route
+	patterns   []string
+	middleware []Middleware
+	timeout    time.Duration
+	logger     *slog.Logger
+	consuming  atomic.Bool
 }
 
-// NewEventRouter creates a new event router
-func NewEventRouter() *EventRouter {
+// NewEventRouter creates a new event router. Handlers are given timeout to
+// process a message unless registered with their own.
+func NewEventRouter(logger *slog.Logger, timeout time.Duration) *EventRouter {
 	return &EventRouter{
-		handlers: make(map[string]EventHandler),
+		handlers: make(map[string][]route),
+		timeout:  timeout,
+		logger:   logger,
+	}
+}
+
+// Consuming reports whether the consumer is receiving deliveries
+func (r *EventRouter) Consuming() bool {
+	return r.consuming.Load()
+}
+
+// RegisterHandler registers a handler for a routing key pattern, e.g.
+// "order.created", "*.deleted" or "order.#". Handlers registered on the same
+// pattern all receive its messages, in registration order.
+func (r *EventRouter) RegisterHandler(pattern string, handler EventHandler, opts ...HandlerOption) {
+	rt := route{handler: handler, timeout: r.timeout, idempotent: true}
+	for _, opt := range opts {
+		opt(&rt)
+	}
+
+	if _, ok := r.handlers[pattern]; !ok {
+		r.patterns = append(r.patterns, pattern)
+		sortBySpecificity(r.patterns)
+	}
+	r.handlers[pattern] = append(r.handlers[pattern], rt)
+}
+
+// Patterns returns the registered patterns, from the most to the least specific
+func (r *EventRouter) Patterns() []string {
+	return slices.Clone(r.patterns)
+}
+
+// messageCorrelationID returns the correlation ID of a delivery, from the
+// CorrelationId property or the correlation header, or a new one when none
+// is valid
+func messageCorrelationID(d amqp.Delivery) string {
+	if logging.ValidCorrelationID(d.CorrelationId) {
+		return d.CorrelationId
+	}
+	for _, header := range []string{CorrelationIDHeader, logging.RequestIDHeader} {
+		if id, ok := d.Headers[header].(string); ok && logging.ValidCorrelationID(id) {
+			return id
+		}
 	}
+	return logging.NewCorrelationID()
 }
 
-// RegisterHandler registers a handler for a specific routing key (event type)
-func (r *EventRouter) RegisterHandler(routingKey string, handler EventHandler) {
-	r.handlers[routingKey] = handler
+// newDelivery returns the metadata and body of a message handed to handlers,
+// unwrapping CloudEvents
+func newDelivery(d amqp.Delivery) (localEvents.Delivery, error) {
+	delivery := localEvents.Delivery{
+		Exchange:      d.Exchange,
+		RoutingKey:    d.RoutingKey,
+		MessageID:     d.MessageId,
+		CorrelationID: messageCorrelationID(d),
+		Timestamp:     d.Timestamp,
+		Redelivered:   d.Redelivered,
+		Headers:       d.Headers,
+		Body:          d.Body,
+	}
+	err := decodeCloudEvent(&delivery, d.ContentType)
+	return delivery, err
+}
+
+// message is a delivery with the metadata and body handed to handlers,
+// decoded once by the dispatcher
+type message struct {
+	amqp     amqp.Delivery
+	delivery localEvents.Delivery
+	// decodeErr tells why the delivery could not be decoded
+	decodeErr error
+}
+
+// newMessage decodes a delivery
+func newMessage(d amqp.Delivery) message {
+	delivery, err := newDelivery(d)
+	return message{amqp: d, delivery: delivery, decodeErr: err}
+}
+
+// handleMessage routes the message to its handlers through the middleware
+// of the router. The handler context is cancelled when the consumer is
+// stopped before it finishes.
+func (r *EventRouter) handleMessage(ctx context.Context, msg message) {
+	stopped := ctx
+	d, delivery, decodeErr := msg.amqp, msg.delivery, msg.decodeErr
+	logger := r.logger.With(slog.String("routing_key", d.RoutingKey))
+	ctx = logging.WithCorrelationID(ctx, delivery.CorrelationID)
+	ctx = logging.WithLogger(ctx, logger)
+
+	// A panic escaping the middleware must not stop the worker
+	defer func() {
+		if p := recover(); p != nil {
+			rejectPanic(ctx, d, &PanicError{Value: p, Stack: debug.Stack()})
+		}
+	}()
+
+	metrics.EventConsumed(d.RoutingKey, delivery.Timestamp)
+
+	if decodeErr != nil {
+		logger.WarnContext(ctx, "Rejecting undecodable message", slog.Any("error", decodeErr))
+		reject(ctx, d)
+		return
+	}
+
+	err := r.process(ctx, delivery)
+	if errors.Is(err, errNoHandler) {
+		logger.WarnContext(ctx, "No handler registered for routing key")
+		// Acknowledge the message to remove it from the queue
+		ack(ctx, d)
+		return
+	}
+
+	if stopped.Err() != nil && (errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)) {
+		// Interrupted by shutdown: give the message back so it is handled
+		// again. Messages handled before the handler noticed are acked below,
+		// or they would be handled twice.
+		logger.WarnContext(ctx, "Message handling interrupted, requeueing")
+		if err := d.Nack(false, true); err != nil {
+			logger.ErrorContext(ctx, "Failed to requeue message", slog.Any("error", err))
+		}
+		return
+	}
+
+	// A panic likely happens again on redelivery, dead-letter the message
+	var panicErr *PanicError
+	if errors.As(err, &panicErr) {
+		rejectPanic(ctx, d, panicErr)
+		return
+	}
+
+	// Invalid messages fail the same way every time, dead-letter them
+	if errors.Is(err, localEvents.ErrInvalidEvent) {
+		logger.WarnContext(ctx, "Rejecting invalid message", slog.Any("error", err))
+		reject(ctx, d)
+		return
+	}
+
+	// Errors are reported by the middleware. You might want to implement
+	// retries here; for now, failed messages are acknowledged too to remove
+	// them from the queue
+	ack(ctx, d)
 }
 
-// handleMessage routes the message to the appropriate handler
-func (r *EventRouter) handleMessage(d amqp.Delivery) {
-	log.Printf("Received message with routing key: %s", d.RoutingKey)
+// errNoHandler is returned for messages no handler is registered for
+var errNoHandler = errors.New("no handler registered for routing key")
 
-	// Find the appropriate handler for this routing key
-	handler, exists := r.handlers[d.RoutingKey]
+// process hands a message to every handler of its pattern, through the
+// middleware of the router
+func (r *EventRouter) process(ctx context.Context, delivery localEvents.Delivery) error {
+	routes, exists := r.find(delivery.RoutingKey)
 	if !exists {
-		// Check if there's a wildcard handler that matches
-		for pattern, wildcardHandler := range r.handlers {
-			if matchesWildcard(pattern, d.RoutingKey) {
-				handler = wildcardHandler
-				exists = true
-				break
+		return errNoHandler
+	}
+	if !slices.ContainsFunc(routes, func(rt route) bool { return rt.idempotent }) {
+		ctx = withoutIdempotency(ctx)
+	}
+
+	handler := r.chain(func(ctx context.Context, delivery localEvents.Delivery) error {
+		var errs []error
+		for _, rt := range routes {
+			if err := rt.run(ctx, delivery); err != nil {
+				errs = append(errs, err)
 			}
 		}
+		return errors.Join(errs...)
+	})
+	return handler(ctx, delivery)
+}
+
+// rejectPanic logs the stack of a handler panic and rejects its message
+func rejectPanic(ctx context.Context, d amqp.Delivery, panicErr *PanicError) {
+	logging.FromContext(ctx).ErrorContext(ctx, "Handler panicked, rejecting message",
+		slog.Any("panic", panicErr.Value),
+		slog.String("stack", string(panicErr.Stack)),
+	)
+	metrics.HandlerPanicked(d.RoutingKey)
+	reject(ctx, d)
+}
+
+// run calls the handler within its timeout
+func (rt route) run(ctx context.Context, delivery localEvents.Delivery) error {
+	if rt.timeout > 0 {
+		return Timeout(rt.timeout)(rt.handler)(ctx, delivery)
 	}
+	return rt.handler(ctx, delivery)
+}
 
-	if !exists {
-		log.Printf("No handler registered for routing key: %s", d.RoutingKey)
-		// Acknowledge the message to remove it from the queue
-		d.Ack(false)
+// find returns the handlers of the pattern equal to the routing key, or else
+// of the most specific pattern matching it
+func (r *EventRouter) find(routingKey string) ([]route, bool) {
+	if routes, ok := r.handlers[routingKey]; ok {
+		return routes, true
+	}
+	for _, pattern := range r.patterns {
+		if MatchTopic(pattern, routingKey) {
+			return r.handlers[pattern], true
+		}
+	}
+	return nil, false
+}
+
+// partitionKey returns the key ordering a message, its routing key when it
+// cannot be decoded, or the handlers define none or their key function panics
+func (r *EventRouter) partitionKey(msg message) (key string) {
+	routingKey := msg.amqp.RoutingKey
+	defer func() {
+		if p := recover(); p != nil {
+			r.logger.Error("Key function panicked", slog.String("routing_key", routingKey), slog.Any("panic", p))
+			key = routingKey
+		}
+	}()
+
+	if msg.decodeErr != nil {
+		return routingKey
+	}
+
+	routes, _ := r.find(routingKey)
+	for _, rt := range routes {
+		if rt.key == nil {
+			continue
+		}
+		if key := rt.key(msg.delivery); key != "" {
+			return key
+		}
+	}
+	return routingKey
+}
+
+// reject rejects a delivery without requeueing it, so the broker moves it to
+// the dead letter exchange of the queue when one is configured
+func reject(ctx context.Context, d amqp.Delivery) {
+	if err := d.Nack(false, false); err != nil {
+		logging.FromContext(ctx).ErrorContext(ctx, "Failed to reject message", slog.Any("error", err))
 		return
 	}
+	metrics.EventRejected(d.RoutingKey)
+}
 
-	// Process the message with the handler
-	err := handler(d.Body)
-	if err != nil {
-		log.Printf("Error processing message: %v", err)
-		// You might want to implement retries or dead letter queue here
-		// For now, we'll just acknowledge the message to remove it from the queue
-		d.Ack(false)
+// ack acknowledges a delivery and counts it
+func ack(ctx context.Context, d amqp.Delivery) {
+	if err := d.Ack(false); err != nil {
+		logging.FromContext(ctx).ErrorContext(ctx, "Failed to acknowledge message", slog.Any("error", err))
 		return
 	}
+	metrics.EventAcked(d.RoutingKey)
+}
+
+// Consumer is a running event consumer
+type Consumer struct {
+	// cancelDeliveries asks the broker to stop delivering, which closes the
+	// delivery channel once the deliveries in flight are received
+	cancelDeliveries func() error
+	queue            string
+	cancel           context.CancelFunc
+	done             chan struct{}
+	logger           *slog.Logger
+}
 
-	// Successfully processed the message, acknowledge it
-	d.Ack(false)
+// Queue returns the name of the consumed queue
+func (c *Consumer) Queue() string {
+	return c.queue
 }
 
-// matchesWildcard checks if a routing key matches a pattern with wildcards
-func matchesWildcard(pattern, routingKey string) bool {
-	// Simple implementation: only supports * at the end
-	if pattern == "#" {
-		return true // # matches anything
+// Stop cancels the consumer so the broker stops delivering, then waits for
+// the messages already received to be handled. When ctx expires first, the
+// handlers still running are cancelled and their messages requeued.
+func (c *Consumer) Stop(ctx context.Context) error {
+	if err := c.cancelDeliveries(); err != nil {
+		c.logger.Error("Failed to cancel consumer", slog.Any("error", err))
 	}
 
-	if len(pattern) > 0 && pattern[len(pattern)-1] == '*' {
-		prefix := pattern[:len(pattern)-1]
-		return len(routingKey) >= len(prefix) && routingKey[:len(prefix)] == prefix
+	select {
+	case <-c.done:
+		c.logger.Info("Event consumer drained")
+		return nil
+	case <-ctx.Done():
 	}
 
-	return pattern == routingKey
+	c.cancel()
+	<-c.done
+	return fmt.Errorf("event consumer not drained in time: %w", ctx.Err())
 }
 
-// StartListening sets up a consumer to listen for RabbitMQ events
-func StartListening(ch *amqp.Channel, router *EventRouter) (string, error) {
-	// Declare a queue with a random name
+// StartListening sets up a consumer to listen for RabbitMQ events. Without a
+// configured queue name, a private queue is created for this instance.
+func StartListening(ch *amqp.Channel, router *EventRouter, cfg config.RabbitMQ) (*Consumer, error) {
+	// A named queue is durable and shared by the replicas, a generated one
+	// lives as long as this consumer
+	named := cfg.Queue != ""
+	var args amqp.Table
+	if cfg.DeadLetterExchange != "" {
+		// Rejected messages go to the dead letter exchange
+		args = amqp.Table{"x-dead-letter-exchange": cfg.DeadLetterExchange}
+	}
 	q, err := ch.QueueDeclare(
-		"",    // name (empty for auto-generated name)
-		false, // durable
-		true,  // delete when unused
-		true,  // exclusive
-		false, // no-wait
-		nil,   // arguments
+		cfg.Queue, // name (empty for auto-generated name)
+		named,     // durable
+		!named,    // delete when unused
+		!named,    // exclusive
+		false,     // no-wait
+		args,      // arguments
 	)
 	if err != nil {
-		return "", err
-	}
-
-	// Bind the queue to the exchange with routing keys
-	for routingKey := range router.handlers {
-		if routingKey == "#" {
-			// Special case: bind to all messages
-			err = ch.QueueBind(
-				q.Name,   // queue name
-				"#",      // routing key
-				"events", // exchange
-				false,    // no-wait
-				nil,      // arguments
-			)
-		} else if len(routingKey) > 0 && routingKey[len(routingKey)-1] == '*' {
-			// Wildcard binding
-			bindingKey := routingKey[:len(routingKey)-1] + "#"
-			err = ch.QueueBind(
-				q.Name,     // queue name
-				bindingKey, // routing key with AMQP wildcard
-				"events",   // exchange
-				false,      // no-wait
-				nil,        // arguments
-			)
-		} else {
-			// Standard binding
-			err = ch.QueueBind(
-				q.Name,     // queue name
-				routingKey, // routing key
-				"events",   // exchange
-				false,      // no-wait
-				nil,        // arguments
-			)
+		return nil, err
+	}
+
+	// Limit the deliveries in flight to this consumer
+	if cfg.Prefetch > 0 {
+		if err := ch.Qos(cfg.Prefetch, 0, false); err != nil {
+			return nil, err
 		}
+	}
 
+	// Bind the queue to the exchange with the patterns of the handlers, which
+	// the broker matches with the same topic semantics as the router
+	for _, pattern := range router.patterns {
+		err = ch.QueueBind(
+			q.Name,       // queue name
+			pattern,      // routing key pattern
+			cfg.Exchange, // exchange
+			false,        // no-wait
+			nil,          // arguments
+		)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 	}
 
 	// Start consuming messages
+	tag := "products-" + logging.NewCorrelationID()
 	msgs, err := ch.Consume(
 		q.Name, // queue
-		"",     // consumer
+		tag,    // consumer
 		false,  // auto-ack (false means manual acknowledgment)
 		false,  // exclusive
 		false,  // no-local
@@ -142,17 +421,70 @@ func StartListening(ch *amqp.Channel, router *EventRouter) (string, error) {
 		nil,    // args
 	)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	consumer := router.consume(msgs, q.Name, cfg.Workers, cfg.Prefetch, func() error {
+		return ch.Cancel(tag, false)
+	})
+
+	router.logger.Info("Started listening for events", slog.String("queue", q.Name), slog.Int("workers", cfg.Workers))
+	return consumer, nil
+}
+
+// consume handles the deliveries of a queue in the background until msgs is
+// closed
+func (r *EventRouter) consume(msgs <-chan amqp.Delivery, queue string, workers, buffer int, cancelDeliveries func() error) *Consumer {
+	ctx, cancel := context.WithCancel(context.Background())
+	consumer := &Consumer{
+		cancelDeliveries: cancelDeliveries,
+		queue:            queue,
+		cancel:           cancel,
+		done:             make(chan struct{}),
+		logger:           r.logger,
 	}
 
-	// Start a goroutine to process messages
+	r.consuming.Store(true)
 	go func() {
-		for d := range msgs {
-			router.handleMessage(d)
-		}
-		log.Println("RabbitMQ consumer channel closed")
+		defer close(consumer.done)
+		r.dispatch(ctx, msgs, workers, buffer)
+		r.consuming.Store(false)
+		r.logger.Warn("RabbitMQ consumer channel closed")
 	}()
 
-	log.Printf("Started listening for events on queue %s", q.Name)
-	return q.Name, nil
+	return consumer
+}
+
+// dispatch spreads the deliveries over a pool of workers by partition key, so
+// messages about one entity are handled in order while different entities are
+// handled in parallel. It returns once msgs is closed and every worker is done.
+func (r *EventRouter) dispatch(ctx context.Context, msgs <-chan amqp.Delivery, workers, buffer int) {
+	workers = max(workers, 1)
+
+	var wg sync.WaitGroup
+	queues := make([]chan message, workers)
+	for i := range queues {
+		// A worker holds at most the prefetched messages, so a slow one only
+		// stalls the dispatcher once the broker would stop delivering anyway
+		queues[i] = make(chan message, buffer)
+		wg.Add(1)
+		go func(queue <-chan message) {
+			defer wg.Done()
+			for msg := range queue {
+				r.handleMessage(ctx, msg)
+			}
+		}(queues[i])
+	}
+
+	for d := range msgs {
+		msg := newMessage(d)
+		hash := fnv.New32a()
+		hash.Write([]byte(r.partitionKey(msg)))
+		queues[hash.Sum32()%uint32(workers)] <- msg
+	}
+
+	for _, queue := range queues {
+		close(queue)
+	}
+	wg.Wait()
 }
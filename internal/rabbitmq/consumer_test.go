@@ -0,0 +1,391 @@
+package rabbitmq_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	localEvents "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/events"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/logging"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/rabbitmq"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// acknowledger records how deliveries are settled, by delivery tag
+type acknowledger struct {
+	mu       sync.Mutex
+	acked    []uint64
+	requeued []uint64
+	rejected []uint64
+}
+
+func (a *acknowledger) Ack(tag uint64, multiple bool) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.acked = append(a.acked, tag)
+	return nil
+}
+
+func (a *acknowledger) Nack(tag uint64, multiple, requeue bool) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if requeue {
+		a.requeued = append(a.requeued, tag)
+	} else {
+		a.rejected = append(a.rejected, tag)
+	}
+	return nil
+}
+
+func (a *acknowledger) Reject(tag uint64, requeue bool) error {
+	return a.Nack(tag, false, requeue)
+}
+
+// settled returns the sorted delivery tags acked, requeued and rejected
+func (a *acknowledger) settled() (acked, requeued, rejected []uint64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return sorted(a.acked), sorted(a.requeued), sorted(a.rejected)
+}
+
+func sorted(tags []uint64) []uint64 {
+	tags = slices.Clone(tags)
+	slices.Sort(tags)
+	return tags
+}
+
+func newRouter() *rabbitmq.EventRouter {
+	return rabbitmq.NewEventRouter(slog.New(slog.NewTextHandler(io.Discard, nil)), 0)
+}
+
+// deliveries returns a buffered delivery channel holding a message per
+// routing key, tagged from 1 in order
+func deliveries(ack amqp.Acknowledger, routingKeys ...string) chan amqp.Delivery {
+	msgs := make(chan amqp.Delivery, len(routingKeys))
+	for i, routingKey := range routingKeys {
+		msgs <- amqp.Delivery{
+			Acknowledger: ack,
+			DeliveryTag:  uint64(i + 1),
+			RoutingKey:   routingKey,
+			ContentType:  "application/json",
+			Body:         []byte(`{}`),
+		}
+	}
+	return msgs
+}
+
+func TestConsumerStopDrains(t *testing.T) {
+	router := newRouter()
+	router.RegisterHandler("order.created", func(ctx context.Context, delivery localEvents.Delivery) error {
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	})
+
+	ack := &acknowledger{}
+	consumer := router.Consume(deliveries(ack, "order.created", "order.created", "order.created"), 2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := consumer.Stop(ctx); err != nil {
+		t.Fatalf("expected the consumer to drain, got %v", err)
+	}
+
+	acked, requeued, rejected := ack.settled()
+	if !slices.Equal(acked, []uint64{1, 2, 3}) || len(requeued) != 0 || len(rejected) != 0 {
+		t.Errorf("expected every message acked, got acked %v requeued %v rejected %v", acked, requeued, rejected)
+	}
+	if router.Consuming() {
+		t.Error("expected the router to stop consuming")
+	}
+}
+
+func TestConsumerStopTimeout(t *testing.T) {
+	router := newRouter()
+	// Interrupted before finishing
+	router.RegisterHandler("order.created", func(ctx context.Context, delivery localEvents.Delivery) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	// Finishes its work despite the cancellation
+	router.RegisterHandler("order.deleted", func(ctx context.Context, delivery localEvents.Delivery) error {
+		<-ctx.Done()
+		return nil
+	})
+
+	ack := &acknowledger{}
+	consumer := router.Consume(deliveries(ack, "order.created", "order.deleted"), 2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := consumer.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the drain to time out, got %v", err)
+	}
+
+	// Only the interrupted message is handled again
+	acked, requeued, rejected := ack.settled()
+	if !slices.Equal(acked, []uint64{2}) || !slices.Equal(requeued, []uint64{1}) || len(rejected) != 0 {
+		t.Errorf("unexpected settlement: acked %v requeued %v rejected %v", acked, requeued, rejected)
+	}
+}
+
+// byEntity partitions messages by their entity header
+func byEntity(delivery localEvents.Delivery) string {
+	entity, _ := delivery.Headers["entity"].(string)
+	return entity
+}
+
+func TestDispatchOrdersMessagesPerKey(t *testing.T) {
+	var mu sync.Mutex
+	handled := map[string][]uint64{}
+
+	router := newRouter()
+	router.RegisterHandler("order.*", func(ctx context.Context, delivery localEvents.Delivery) error {
+		// Later messages of a key would overtake slower earlier ones if
+		// they were handled in parallel
+		tag, _ := delivery.Headers["tag"].(int)
+		time.Sleep(time.Duration(5-tag%5) * time.Millisecond)
+
+		mu.Lock()
+		defer mu.Unlock()
+		entity := byEntity(delivery)
+		handled[entity] = append(handled[entity], uint64(tag))
+		return nil
+	}, rabbitmq.WithKey(byEntity))
+
+	ack := &acknowledger{}
+	msgs := make(chan amqp.Delivery, 20)
+	want := map[string][]uint64{}
+	for tag := 1; tag <= 20; tag++ {
+		entity := []string{"order:1", "order:2", "order:3"}[tag%3]
+		want[entity] = append(want[entity], uint64(tag))
+		msgs <- amqp.Delivery{
+			Acknowledger: ack,
+			DeliveryTag:  uint64(tag),
+			RoutingKey:   "order.updated",
+			Headers:      amqp.Table{"entity": entity, "tag": tag},
+			Body:         []byte(`{}`),
+		}
+	}
+	close(msgs)
+
+	router.Dispatch(context.Background(), msgs, 4)
+
+	for entity, tags := range want {
+		if !slices.Equal(handled[entity], tags) {
+			t.Errorf("expected %s handled in delivery order %v, got %v", entity, tags, handled[entity])
+		}
+	}
+	if acked, _, _ := ack.settled(); len(acked) != 20 {
+		t.Errorf("expected every message acked, got %v", acked)
+	}
+}
+
+func TestDispatchHandlesKeysConcurrently(t *testing.T) {
+	started := map[string]chan struct{}{"order:1": make(chan struct{}), "order:2": make(chan struct{})}
+
+	router := newRouter()
+	router.RegisterHandler("order.*", func(ctx context.Context, delivery localEvents.Delivery) error {
+		entity := byEntity(delivery)
+		close(started[entity])
+
+		// Each message waits for the other: handled one after the other,
+		// the first would wait forever
+		other := started["order:1"]
+		if entity == "order:1" {
+			other = started["order:2"]
+		}
+		select {
+		case <-other:
+			return nil
+		case <-time.After(time.Second):
+			return errors.New("timed out waiting for the other key")
+		}
+	}, rabbitmq.WithKey(byEntity))
+
+	errs := recordErrors(router)
+
+	ack := &acknowledger{}
+	msgs := make(chan amqp.Delivery, 2)
+	// order:1 and order:2 hash to different workers of 4
+	for tag, entity := range []string{"order:1", "order:2"} {
+		msgs <- amqp.Delivery{
+			Acknowledger: ack,
+			DeliveryTag:  uint64(tag + 1),
+			RoutingKey:   "order.updated",
+			Headers:      amqp.Table{"entity": entity},
+			Body:         []byte(`{}`),
+		}
+	}
+	close(msgs)
+
+	router.Dispatch(context.Background(), msgs, 4)
+
+	if got := errs(); len(got) != 0 {
+		t.Errorf("expected different keys to be handled concurrently, got %v", got)
+	}
+}
+
+// recordErrors collects the errors returned by the handlers of a router
+func recordErrors(router *rabbitmq.EventRouter) func() []error {
+	var mu sync.Mutex
+	var errs []error
+	router.Use(func(next rabbitmq.EventHandler) rabbitmq.EventHandler {
+		return func(ctx context.Context, delivery localEvents.Delivery) error {
+			err := next(ctx, delivery)
+			if err != nil {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}
+			return err
+		}
+	})
+	return func() []error {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(errs)
+	}
+}
+
+func TestRouterHandlerTimeouts(t *testing.T) {
+	router := rabbitmq.NewEventRouter(slog.New(slog.NewTextHandler(io.Discard, nil)), 10*time.Millisecond)
+	errs := recordErrors(router)
+
+	deadlines := map[string]time.Duration{}
+	var mu sync.Mutex
+	recordDeadline := func(name string, ctx context.Context) {
+		mu.Lock()
+		defer mu.Unlock()
+		if deadline, ok := ctx.Deadline(); ok {
+			deadlines[name] = time.Until(deadline)
+		}
+	}
+
+	// The router timeout applies by default
+	router.RegisterHandler("order.created", func(ctx context.Context, delivery localEvents.Delivery) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	router.RegisterHandler("order.updated", func(ctx context.Context, delivery localEvents.Delivery) error {
+		recordDeadline("own", ctx)
+		return nil
+	}, rabbitmq.WithTimeout(time.Minute))
+	router.RegisterHandler("order.deleted", func(ctx context.Context, delivery localEvents.Delivery) error {
+		recordDeadline("none", ctx)
+		return nil
+	}, rabbitmq.WithTimeout(0))
+
+	ack := &acknowledger{}
+	msgs := deliveries(ack, "order.created", "order.updated", "order.deleted")
+	close(msgs)
+	router.Dispatch(context.Background(), msgs, 1)
+
+	got := errs()
+	if len(got) != 1 || !errors.Is(got[0], context.DeadlineExceeded) || !strings.Contains(got[0].Error(), "timed out after 10ms") {
+		t.Errorf("expected the default timeout to stop the first handler, got %v", got)
+	}
+	if own, ok := deadlines["own"]; !ok || own < 30*time.Second {
+		t.Errorf("expected the handler timeout to override the router one, got %v", own)
+	}
+	if _, ok := deadlines["none"]; ok {
+		t.Error("expected no deadline for a handler registered without timeout")
+	}
+	// Timed out messages are settled like other failures
+	if acked, _, _ := ack.settled(); len(acked) != 3 {
+		t.Errorf("expected every message acked, got %v", acked)
+	}
+}
+
+func TestRouterCancellationReachesHandler(t *testing.T) {
+	router := newRouter()
+	errs := recordErrors(router)
+
+	started := make(chan struct{})
+	var correlationID string
+	router.RegisterHandler("order.created", func(ctx context.Context, delivery localEvents.Delivery) error {
+		correlationID = logging.CorrelationID(ctx)
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	msgs := make(chan amqp.Delivery, 1)
+	msgs <- amqp.Delivery{
+		Acknowledger:  &acknowledger{},
+		RoutingKey:    "order.created",
+		CorrelationId: "corr-1",
+		Body:          []byte(`{}`),
+	}
+	close(msgs)
+
+	go func() {
+		<-started
+		cancel()
+	}()
+	router.Dispatch(ctx, msgs, 1)
+
+	if got := errs(); len(got) != 1 || !errors.Is(got[0], context.Canceled) {
+		t.Errorf("expected the handler to see the cancellation, got %v", got)
+	}
+	if correlationID != "corr-1" {
+		t.Errorf("expected the correlation ID in the handler context, got %q", correlationID)
+	}
+}
+
+func TestRouterSkipsIdempotencyForCatchAll(t *testing.T) {
+	store := memoryStore{}
+	router := newRouter()
+	router.Use(rabbitmq.Idempotent(store))
+
+	router.RegisterHandler("order.created", func(ctx context.Context, delivery localEvents.Delivery) error { return nil })
+	router.RegisterHandler("#", func(ctx context.Context, delivery localEvents.Delivery) error { return nil }, rabbitmq.WithoutIdempotency())
+
+	ack := &acknowledger{}
+	msgs := deliveries(ack, "order.created", "product.updated")
+	for range len(msgs) {
+		d := <-msgs
+		d.MessageId = fmt.Sprintf("m%d", d.DeliveryTag)
+		msgs <- d
+	}
+	close(msgs)
+	router.Dispatch(context.Background(), msgs, 1)
+
+	if len(store) != 1 || store["m1"] != "order.created" {
+		t.Errorf("expected only the order.created message recorded, got %v", store)
+	}
+}
+
+func TestDeliveryReplacesInvalidCorrelationID(t *testing.T) {
+	forged := "abc\n{\"level\":\"ERROR\"}"
+	delivery, err := rabbitmq.DecodeDelivery(amqp.Delivery{
+		CorrelationId: forged,
+		Headers:       amqp.Table{rabbitmq.CorrelationIDHeader: strings.Repeat("a", 129)},
+		Body:          []byte(`{}`),
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !logging.ValidCorrelationID(delivery.CorrelationID) {
+		t.Errorf("expected a generated correlation ID, got %q", delivery.CorrelationID)
+	}
+
+	delivery, err = rabbitmq.DecodeDelivery(amqp.Delivery{
+		CorrelationId: forged,
+		Headers:       amqp.Table{rabbitmq.CorrelationIDHeader: "corr-1"},
+		Body:          []byte(`{}`),
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if delivery.CorrelationID != "corr-1" {
+		t.Errorf("expected the valid header to be used, got %q", delivery.CorrelationID)
+	}
+}
@@ -1,32 +1,66 @@
 package rabbitmq
 
 import (
+	"log/slog"
+
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/config"
+	localEvents "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/events"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/inventory"
 	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/rabbitmq/event_handlers"
 	"gorm.io/gorm"
 )
 
-// SetupEventHandlers configures handlers for different event types
-func SetupEventHandlers(dbConn *gorm.DB) *EventRouter {
-	router := NewEventRouter()
+// SetupEventHandlers configures handlers for different event types. Consumed
+// messages are recorded in archive unless it is nil.
+func SetupEventHandlers(dbConn *gorm.DB, publisher *Publisher, archive *EventArchive, allocation inventory.AllocationStrategy, cfg config.RabbitMQ, logger *slog.Logger) (*EventRouter, error) {
+	schemas, err := localEvents.ConsumedSchemas()
+	if err != nil {
+		return nil, err
+	}
+
+	router := NewEventRouter(logger, cfg.HandlerTimeout)
+	router.Use(Tracing(), Logging(), Metrics())
+	if archive != nil {
+		// Outside Recover, to archive panics as rejections. The events of
+		// this service, consumed through the debug binding, are archived
+		// once as published.
+		router.Use(Archive(archive, cfg.CloudEventsSource))
+	}
+	router.Use(
+		Recover(),
+		Validate(schemas),
+		Idempotent(NewProcessedMessageStore(dbConn)),
+	)
 
 	// Initialize event handlers
-	customerHandlers := event_handlers.NewCustomerEventHandlers(dbConn)
-	orderHandlers := event_handlers.NewOrderEventHandlers(dbConn)
-	debugHandlers := event_handlers.NewDebugEventHandlers()
+	customerHandlers := event_handlers.NewCustomerEventHandlers(dbConn, logger)
+	orderHandlers := event_handlers.NewOrderEventHandlers(dbConn, logger, allocation, publisher.PublishStockEvent)
+	snapshotHandlers := event_handlers.NewSnapshotEventHandlers(dbConn, logger, cfg.SnapshotBatchSize, publisher.PublishProductSnapshot)
+	debugHandlers := event_handlers.NewDebugEventHandlers(logger)
+
+	// Register customer event handlers, ordered per customer
+	byCustomer := WithKey(event_handlers.CustomerKey)
+	Register(router, "customer.created", customerHandlers.HandleCustomerCreated, byCustomer)
+	Register(router, "customer.updated", customerHandlers.HandleCustomerUpdated, byCustomer)
+	Register(router, "customer.deleted", customerHandlers.HandleCustomerDeleted, byCustomer)
 
-	// Register customer event handlers
-	router.RegisterHandler("customer.created", customerHandlers.HandleCustomerCreated)
-	router.RegisterHandler("customer.updated", customerHandlers.HandleCustomerUpdated)
-	router.RegisterHandler("customer.deleted", customerHandlers.HandleCustomerDeleted)
+	// Register order event handlers, ordered per order
+	byOrder := WithKey(event_handlers.OrderKey)
+	Register(router, "order.created", orderHandlers.HandleOrderCreated, byOrder)
+	Register(router, "order.updated", orderHandlers.HandleOrderUpdated, byOrder)
+	Register(router, "order.deleted", orderHandlers.HandleOrderDeleted, byOrder)
 
-	// Register order event handlers
-	router.RegisterHandler("order.created", orderHandlers.HandleOrderCreated)
-	router.RegisterHandler("order.updated", orderHandlers.HandleOrderUpdated)
-	router.RegisterHandler("order.deleted", orderHandlers.HandleOrderDeleted)
+	// Register snapshot handlers. Answering a request takes as long as the
+	// catalogue needs, each publish and query having its own timeout.
+	Register(router, "product.snapshot.requested", snapshotHandlers.HandleProductSnapshotRequested, WithTimeout(0))
+	Register(router, "customer.snapshot", snapshotHandlers.HandleCustomerSnapshot)
+	Register(router, "order.snapshot", snapshotHandlers.HandleOrderSnapshot)
 
 	// Register debug catch-all handler
-	// Useful during development, can be removed in production
-	router.RegisterHandler("#", debugHandlers.HandleAllEvents)
+	// Useful during development, can be removed in production. It only logs,
+	// so its messages, the events of this service included, are not recorded
+	// as processed.
+	router.RegisterHandler("#", debugHandlers.HandleAllEvents, WithoutIdempotency())
 
-	return router
+	return router, nil
 }
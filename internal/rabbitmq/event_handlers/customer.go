@@ -1,86 +1,84 @@
 package event_handlers
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"fmt"
+	"log/slog"
 
 	"github.com/PayeTonKawa-EPSI-2025/Common-V2/events"
+	localEvents "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/events"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/mirror"
 	localModels "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/models"
 	"gorm.io/gorm"
 )
 
 // CustomerEventHandlers provides handlers for customer-related events
 type CustomerEventHandlers struct {
-	db *gorm.DB
+	db     *gorm.DB
+	logger *slog.Logger
 }
 
 // NewCustomerEventHandlers creates a new customer event handlers instance
-func NewCustomerEventHandlers(db *gorm.DB) *CustomerEventHandlers {
-	return &CustomerEventHandlers{db: db}
+func NewCustomerEventHandlers(db *gorm.DB, logger *slog.Logger) *CustomerEventHandlers {
+	return &CustomerEventHandlers{db: db, logger: logger}
 }
 
-// HandleCustomerCreated handles the customer.created event
-func (h *CustomerEventHandlers) HandleCustomerCreated(body []byte) error {
+// CustomerKey partitions customer events by customer, so the events of one
+// customer are handled in the order they were published
+func CustomerKey(delivery localEvents.Delivery) string {
 	var event events.CustomerEvent
-	if err := json.Unmarshal(body, &event); err != nil {
-		log.Printf("Error unmarshaling customer.created event: %v", err)
-		return err
+	if err := json.Unmarshal(delivery.Body, &event); err != nil {
+		return ""
 	}
+	return fmt.Sprintf("customer:%d", event.Customer.ID)
+}
 
-	log.Printf("Received customer.created event for customer %d", event.Customer.ID)
+// HandleCustomerCreated handles the customer.created event
+func (h *CustomerEventHandlers) HandleCustomerCreated(ctx context.Context, event events.CustomerEvent) error {
+	logger := h.logger.With(slog.Uint64("customer_id", uint64(event.Customer.ID)))
+	logger.InfoContext(ctx, "Received customer.created event")
 
-	// Create the customer in the local database
-	customer := localModels.Customer{}
-	customer.ID = event.Customer.ID
+	// Create the customer in the local database, already there on replay
+	customer := mirror.Customer(event.Customer, event.Timestamp)
 
-	if err := h.db.Create(&customer).Error; err != nil {
-		log.Printf("Error creating customer in DB: %v", err)
+	if err := mirror.SaveCustomers(h.db.WithContext(ctx), customer); err != nil {
+		logger.ErrorContext(ctx, "Error creating customer in DB", slog.Any("error", err))
 		return err
 	}
 
-	log.Printf("Successfully created customer %d in local database", customer.ID)
+	logger.InfoContext(ctx, "Successfully created customer in local database")
 	return nil
 }
 
 // HandleCustomerUpdated handles the customer.updated event
-func (h *CustomerEventHandlers) HandleCustomerUpdated(body []byte) error {
-	var event events.CustomerEvent
-	if err := json.Unmarshal(body, &event); err != nil {
-		log.Printf("Error unmarshaling customer.updated event: %v", err)
-		return err
-	}
-
-	log.Printf("Received customer.updated event for customer %d", event.Customer.ID)
+func (h *CustomerEventHandlers) HandleCustomerUpdated(ctx context.Context, event events.CustomerEvent) error {
+	logger := h.logger.With(slog.Uint64("customer_id", uint64(event.Customer.ID)))
+	logger.InfoContext(ctx, "Received customer.updated event")
 
-	// Update the customer in the local database
-	customer := localModels.Customer{}
-	customer.ID = event.Customer.ID
+	// Update the customer in the local database, unless a newer event was applied
+	customer := mirror.Customer(event.Customer, event.Timestamp)
 
-	if err := h.db.Save(&customer).Error; err != nil {
-		log.Printf("Error updating customer in DB: %v", err)
+	if err := mirror.SaveCustomers(h.db.WithContext(ctx), customer); err != nil {
+		logger.ErrorContext(ctx, "Error updating customer in DB", slog.Any("error", err))
 		return err
 	}
 
-	log.Printf("Successfully updated customer %d in local database", customer.ID)
+	logger.InfoContext(ctx, "Successfully updated customer in local database")
 	return nil
 }
 
 // HandleCustomerDeleted handles the customer.deleted event
-func (h *CustomerEventHandlers) HandleCustomerDeleted(body []byte) error {
-	var event events.CustomerEvent
-	if err := json.Unmarshal(body, &event); err != nil {
-		log.Printf("Error unmarshaling customer.deleted event: %v", err)
-		return err
-	}
-
-	log.Printf("Received customer.deleted event for customer %d", event.Customer.ID)
+func (h *CustomerEventHandlers) HandleCustomerDeleted(ctx context.Context, event events.CustomerEvent) error {
+	logger := h.logger.With(slog.Uint64("customer_id", uint64(event.Customer.ID)))
+	logger.InfoContext(ctx, "Received customer.deleted event")
 
 	// Delete the customer from the local database
-	if err := h.db.Delete(&localModels.Customer{}, event.Customer.ID).Error; err != nil {
-		log.Printf("Error deleting customer from DB: %v", err)
+	if err := h.db.WithContext(ctx).Delete(&localModels.Customer{}, event.Customer.ID).Error; err != nil {
+		logger.ErrorContext(ctx, "Error deleting customer from DB", slog.Any("error", err))
 		return err
 	}
 
-	log.Printf("Successfully deleted customer %d from local database", event.Customer.ID)
+	logger.InfoContext(ctx, "Successfully deleted customer from local database")
 	return nil
 }
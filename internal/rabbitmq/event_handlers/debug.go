@@ -1,33 +1,41 @@
 package event_handlers
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"log/slog"
 
 	"github.com/PayeTonKawa-EPSI-2025/Common-V2/events"
+	localEvents "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/events"
 )
 
 // DebugEventHandlers provides handlers for debugging purposes
-type DebugEventHandlers struct{}
+type DebugEventHandlers struct {
+	logger *slog.Logger
+}
 
 // NewDebugEventHandlers creates a new debug event handlers instance
-func NewDebugEventHandlers() *DebugEventHandlers {
-	return &DebugEventHandlers{}
+func NewDebugEventHandlers(logger *slog.Logger) *DebugEventHandlers {
+	return &DebugEventHandlers{logger: logger}
 }
 
 // HandleAllEvents is a catch-all handler for debugging purposes
 // Useful during development, can be removed in production
-func (h *DebugEventHandlers) HandleAllEvents(body []byte) error {
+func (h *DebugEventHandlers) HandleAllEvents(ctx context.Context, delivery localEvents.Delivery) error {
 	var generic events.GenericEvent
-	if err := json.Unmarshal(body, &generic); err != nil {
-		log.Printf("Error unmarshaling generic event: %v", err)
+	if err := json.Unmarshal(delivery.Body, &generic); err != nil {
+		h.logger.DebugContext(ctx, "Error unmarshaling generic event", slog.Any("error", err))
 		// Don't return error here as it might be a different format
 		// Just log and continue
 	} else {
-		log.Printf("Received event of type %s", generic.Type)
+		h.logger.DebugContext(ctx, "Received event",
+			slog.String("event_type", generic.Type),
+			slog.String("message_id", delivery.MessageID),
+			slog.Bool("redelivered", delivery.Redelivered),
+		)
 	}
 
 	// Log the raw message for debugging
-	log.Printf("Raw event: %s", string(body))
+	h.logger.DebugContext(ctx, "Raw event", slog.String("body", string(delivery.Body)))
 	return nil
 }
@@ -1,137 +1,238 @@
 package event_handlers
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
 
 	"github.com/PayeTonKawa-EPSI-2025/Common-V2/events"
-	"github.com/PayeTonKawa-EPSI-2025/Common-V2/models"
+	localEvents "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/events"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/inventory"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/metrics"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/mirror"
 	localModels "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/models"
 	"gorm.io/gorm"
 )
 
+// StockAlertPublisher publishes a stock alert raised while handling an event
+type StockAlertPublisher func(ctx context.Context, eventType events.EventType, product localModels.Product) error
+
 // OrderEventHandlers provides handlers for order-related events
 type OrderEventHandlers struct {
-	db *gorm.DB
+	db                *gorm.DB
+	logger            *slog.Logger
+	allocation        inventory.AllocationStrategy
+	publishStockAlert StockAlertPublisher
 }
 
 // NewOrderEventHandlers creates a new order event handlers instance
-func NewOrderEventHandlers(db *gorm.DB) *OrderEventHandlers {
-	return &OrderEventHandlers{db: db}
+func NewOrderEventHandlers(db *gorm.DB, logger *slog.Logger, allocation inventory.AllocationStrategy, publishStockAlert StockAlertPublisher) *OrderEventHandlers {
+	return &OrderEventHandlers{db: db, logger: logger, allocation: allocation, publishStockAlert: publishStockAlert}
 }
 
-// HandleOrderCreated handles the order.created event
-func (h *OrderEventHandlers) HandleOrderCreated(body []byte) error {
+// OrderKey partitions order events by order, so the events of one order are
+// handled in the order they were published
+func OrderKey(delivery localEvents.Delivery) string {
 	var event events.OrderEvent
-	if err := json.Unmarshal(body, &event); err != nil {
-		log.Printf("Error unmarshaling order.created event: %v", err)
-		return err
+	if err := json.Unmarshal(delivery.Body, &event); err != nil {
+		return ""
 	}
+	return fmt.Sprintf("order:%d", event.Order.OrderID)
+}
 
-	log.Printf("Received order.created event for order %d", event.Order.OrderID)
+// HandleOrderCreated handles the order.created event
+func (h *OrderEventHandlers) HandleOrderCreated(ctx context.Context, event events.OrderEvent) error {
+	logger := h.logger.With(slog.Uint64("order_id", uint64(event.Order.OrderID)))
+	logger.InfoContext(ctx, "Received order.created event")
 
-	// Create the order in the local database
-	order := localModels.Order{}
-	order.ID = event.Order.OrderID
+	// Create the order in the local database, already there on replay
+	order := mirror.Order(event.Order.OrderID, event.Order.CustomerID, event.Timestamp)
 
-	if err := h.db.Create(&order).Error; err != nil {
-		log.Printf("Error creating order in DB: %v", err)
+	if err := mirror.SaveOrders(h.db.WithContext(ctx), order); err != nil {
+		logger.ErrorContext(ctx, "Error creating order in DB", slog.Any("error", err))
 		return err
 	}
 
-	log.Printf("Successfully created order %d in local database", order.ID)
+	logger.InfoContext(ctx, "Successfully created order in local database")
+
+	// The stock of an order handled before is already taken: only rebuild
+	// its products from the ledger
+	restored, err := h.restoreOrderProducts(ctx, event.Order.OrderID)
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to restore order products", slog.Any("error", err))
+		return err
+	}
+	if restored {
+		logger.InfoContext(ctx, "Order products already known or restored from the stock ledger")
+		return nil
+	}
 
-	// Begin a transaction
-	tx := h.db.Begin()
+	// Begin a transaction, rolled back if the context is cancelled on shutdown
+	tx := h.db.WithContext(ctx).Begin()
 
 	if tx.Error != nil {
-		log.Printf("Failed to start transaction: %v\n", tx.Error)
+		logger.ErrorContext(ctx, "Failed to start transaction", slog.Any("error", tx.Error))
 		return nil
 	}
 
 	var orderProducts []localModels.OrderProduct
+	var alerts []stockAlert
+
+	// Lock the products in ID order, so orders handled in parallel sharing
+	// products wait for each other instead of deadlocking
+	productIDs := slices.Clone(event.Order.ProductIDs)
+	slices.Sort(productIDs)
 
-	for _, productID := range event.Order.ProductIDs {
-		// Decrement stock safely (only if stock > 0)
-		result := tx.Model(&models.Product{}).
-			Where("id = ? AND stock > 0", productID).
-			UpdateColumn("stock", gorm.Expr("stock - ?", 1))
+	for _, productID := range productIDs {
+		productLogger := logger.With(slog.Uint64("product_id", uint64(productID)))
 
-		if result.Error != nil {
+		// Lock the product row so the stock read below stays accurate until commit
+		product, err := inventory.Lock(tx, productID)
+		if err != nil {
 			tx.Rollback()
-			log.Printf("Failed to update stock for product %d: %v\n", productID, result.Error)
+			productLogger.ErrorContext(ctx, "Failed to load product", slog.Any("error", err))
 			return nil
 		}
 
-		if result.RowsAffected == 0 {
+		// Only active products can be sold
+		if product.Status != localModels.ProductStatusActive {
 			tx.Rollback()
-			log.Printf("Product %d has no stock left\n", productID)
+			productLogger.WarnContext(ctx, "Product is not for sale", slog.String("status", string(product.Status)))
 			return nil
 		}
 
+		// Take the unit from a warehouse chosen by the allocation strategy
+		stockBefore := product.Stock
+		warehouseID, err := inventory.Allocate(tx, &product, 1, h.allocation, inventory.ReasonOrder, fmt.Sprintf("order:%d", event.Order.OrderID))
+
+		if errors.Is(err, inventory.ErrInsufficientStock) {
+			tx.Rollback()
+			productLogger.WarnContext(ctx, "Product has no stock left")
+			return nil
+		}
+
+		if err != nil {
+			tx.Rollback()
+			productLogger.ErrorContext(ctx, "Failed to update stock", slog.Any("error", err))
+			return nil
+		}
+
+		if eventType, ok := localEvents.StockAlertFor(stockBefore, product.Stock, product.ReorderThreshold); ok {
+			alerts = append(alerts, stockAlert{eventType: eventType, product: product})
+		}
+
 		orderProducts = append(orderProducts, localModels.OrderProduct{
-			OrderID:   event.Order.OrderID,
-			ProductID: productID,
+			OrderID:     event.Order.OrderID,
+			ProductID:   productID,
+			WarehouseID: warehouseID,
 		})
 	}
 
 	// Create all OrderProduct links
 	if err := tx.Create(&orderProducts).Error; err != nil {
 		tx.Rollback()
-		log.Printf("Failed to create OrderProduct records: %v\n", err)
+		logger.ErrorContext(ctx, "Failed to create OrderProduct records", slog.Any("error", err))
 		return nil
 	}
 
 	// Commit transaction
 	if err := tx.Commit().Error; err != nil {
-		log.Printf("Failed to commit transaction: %v\n", err)
+		logger.ErrorContext(ctx, "Failed to commit transaction", slog.Any("error", err))
 		return nil
 	}
 
-	log.Printf("Successfully created order products for order %d in local database", order.ID)
+	logger.InfoContext(ctx, "Successfully created order products in local database")
+
+	// Only announce stock alerts once the decrements are committed
+	for _, alert := range alerts {
+		if alert.eventType == localEvents.ProductOutOfStock {
+			metrics.StockOut(alert.product.ID)
+		}
+		if err := h.publishStockAlert(ctx, alert.eventType, alert.product); err != nil {
+			logger.ErrorContext(ctx, "Failed to publish stock alert",
+				slog.String("event_type", string(alert.eventType)),
+				slog.Uint64("product_id", uint64(alert.product.ID)),
+				slog.Any("error", err),
+			)
+		}
+	}
 
 	return nil
 }
 
-// HandleOrderUpdated handles the order.updated event
-func (h *OrderEventHandlers) HandleOrderUpdated(body []byte) error {
-	var event events.OrderEvent
-	if err := json.Unmarshal(body, &event); err != nil {
-		log.Printf("Error unmarshaling order.updated event: %v", err)
-		return err
+// restoreOrderProducts rebuilds the products of an order from the stock it
+// took, reporting false when the order has no products and never took any
+func (h *OrderEventHandlers) restoreOrderProducts(ctx context.Context, orderID uint) (bool, error) {
+	tx := h.db.WithContext(ctx)
+
+	// Also true of orders seeded from a snapshot
+	var count int64
+	if err := tx.Model(&localModels.OrderProduct{}).Where("order_id = ?", orderID).Count(&count).Error; err != nil {
+		return false, err
+	}
+	if count > 0 {
+		return true, nil
 	}
 
-	log.Printf("Received order.updated event for order %d", event.Order.OrderID)
+	movements, err := inventory.Movements(tx, inventory.ReasonOrder, fmt.Sprintf("order:%d", orderID))
+	if err != nil || len(movements) == 0 {
+		return false, err
+	}
 
-	// Update the order in the local database
-	order := localModels.Order{}
-	order.ID = event.Order.OrderID
+	var orderProducts []localModels.OrderProduct
+	for _, movement := range movements {
+		// Each unit taken is one order product
+		for range -movement.Delta {
+			orderProducts = append(orderProducts, localModels.OrderProduct{
+				OrderID:     orderID,
+				ProductID:   movement.ProductID,
+				WarehouseID: movement.WarehouseID,
+			})
+		}
+	}
+	if len(orderProducts) == 0 {
+		return true, nil
+	}
+	return true, tx.Create(&orderProducts).Error
+}
+
+// stockAlert is a stock alert waiting for its transaction to commit
+type stockAlert struct {
+	eventType events.EventType
+	product   localModels.Product
+}
+
+// HandleOrderUpdated handles the order.updated event
+func (h *OrderEventHandlers) HandleOrderUpdated(ctx context.Context, event events.OrderEvent) error {
+	logger := h.logger.With(slog.Uint64("order_id", uint64(event.Order.OrderID)))
+	logger.InfoContext(ctx, "Received order.updated event")
 
-	if err := h.db.Save(&order).Error; err != nil {
-		log.Printf("Error updating order in DB: %v", err)
+	// Update the order in the local database, unless a newer event was applied
+	order := mirror.Order(event.Order.OrderID, event.Order.CustomerID, event.Timestamp)
+
+	if err := mirror.SaveOrders(h.db.WithContext(ctx), order); err != nil {
+		logger.ErrorContext(ctx, "Error updating order in DB", slog.Any("error", err))
 		return err
 	}
 
-	log.Printf("Successfully updated order %d in local database", order.ID)
+	logger.InfoContext(ctx, "Successfully updated order in local database")
 	return nil
 }
 
 // HandleOrderDeleted handles the order.deleted event
-func (h *OrderEventHandlers) HandleOrderDeleted(body []byte) error {
-	var event events.OrderEvent
-	if err := json.Unmarshal(body, &event); err != nil {
-		log.Printf("Error unmarshaling order.deleted event: %v", err)
-		return err
-	}
-
-	log.Printf("Received order.deleted event for order %d", event.Order.OrderID)
+func (h *OrderEventHandlers) HandleOrderDeleted(ctx context.Context, event events.OrderEvent) error {
+	logger := h.logger.With(slog.Uint64("order_id", uint64(event.Order.OrderID)))
+	logger.InfoContext(ctx, "Received order.deleted event")
 
-	// Delete the order from the local database
-	if err := h.db.Delete(&localModels.Order{}, event.Order.OrderID).Error; err != nil {
-		log.Printf("Error deleting order from DB: %v", err)
+	// Cancel and delete the order from the local database
+	if err := mirror.CancelOrder(h.db.WithContext(ctx), event.Order.OrderID, event.Timestamp); err != nil {
+		logger.ErrorContext(ctx, "Error deleting order from DB", slog.Any("error", err))
 		return err
 	}
 
-	log.Printf("Successfully deleted order %d from local database", event.Order.OrderID)
+	logger.InfoContext(ctx, "Successfully deleted order from local database")
 	return nil
 }
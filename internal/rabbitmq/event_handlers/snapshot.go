@@ -0,0 +1,184 @@
+package event_handlers
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+
+	"github.com/PayeTonKawa-EPSI-2025/Common-V2/models"
+	localEvents "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/events"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/logging"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/mirror"
+	localModels "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/models"
+	"gorm.io/gorm"
+)
+
+// maxSnapshotBatchSize caps the batch size a snapshot request may ask for
+const maxSnapshotBatchSize = 1000
+
+// ProductSnapshotPublisher publishes one batch of a product snapshot
+type ProductSnapshotPublisher func(ctx context.Context, event localEvents.ProductSnapshotEvent) error
+
+// SnapshotEventHandlers answers product snapshot requests and seeds the local
+// tables from customer and order snapshots
+type SnapshotEventHandlers struct {
+	db                     *gorm.DB
+	logger                 *slog.Logger
+	batchSize              int
+	publishProductSnapshot ProductSnapshotPublisher
+}
+
+// NewSnapshotEventHandlers creates a new snapshot event handlers instance
+func NewSnapshotEventHandlers(db *gorm.DB, logger *slog.Logger, batchSize int, publishProductSnapshot ProductSnapshotPublisher) *SnapshotEventHandlers {
+	return &SnapshotEventHandlers{db: db, logger: logger, batchSize: batchSize, publishProductSnapshot: publishProductSnapshot}
+}
+
+// HandleProductSnapshotRequested handles the product.snapshot.requested event
+// by publishing every product in product.snapshot batches
+func (h *SnapshotEventHandlers) HandleProductSnapshotRequested(ctx context.Context, request localEvents.SnapshotRequest) error {
+	// Answer with the correlation ID of the request
+	correlationID := request.CorrelationID
+	if correlationID == "" {
+		correlationID = logging.CorrelationID(ctx)
+	}
+	ctx = logging.WithCorrelationID(ctx, correlationID)
+	logger := h.logger.With(slog.String("snapshot_id", correlationID))
+	logger.InfoContext(ctx, "Received product.snapshot.requested event")
+
+	batchSize := h.batchSize
+	if request.BatchSize > 0 {
+		batchSize = min(request.BatchSize, maxSnapshotBatchSize)
+	}
+
+	// Each batch is held until the next one is read, so the last one can be
+	// marked as such
+	var pending []models.Product
+	batch, total := 0, 0
+	flush := func(last bool) error {
+		batch++
+		total += len(pending)
+		event := localEvents.ProductSnapshotEvent{
+			Snapshot: localEvents.Snapshot{CorrelationID: correlationID, Batch: batch, Last: last},
+			Products: pending,
+		}
+		if last {
+			event.Total = total
+		}
+		return h.publishProductSnapshot(ctx, event)
+	}
+
+	var products []localModels.Product
+	err := h.db.WithContext(ctx).FindInBatches(&products, batchSize, func(tx *gorm.DB, _ int) error {
+		if pending != nil {
+			if err := flush(false); err != nil {
+				return err
+			}
+		}
+		pending = make([]models.Product, len(products))
+		for i, product := range products {
+			pending[i] = product.Product
+		}
+		return nil
+	}).Error
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to publish product snapshot", slog.Int("batch", batch), slog.Any("error", err))
+		return err
+	}
+
+	// An empty catalogue still gets its completion marker
+	if pending == nil {
+		pending = []models.Product{}
+	}
+	if err := flush(true); err != nil {
+		logger.ErrorContext(ctx, "Failed to publish product snapshot", slog.Int("batch", batch), slog.Any("error", err))
+		return err
+	}
+
+	logger.InfoContext(ctx, "Published product snapshot", slog.Int("batches", batch), slog.Int("products", total))
+	return nil
+}
+
+// HandleCustomerSnapshot handles a customer.snapshot batch, adding the
+// customers missing from the local database and updating the others
+func (h *SnapshotEventHandlers) HandleCustomerSnapshot(ctx context.Context, event localEvents.CustomerSnapshotEvent) error {
+	logger := h.logger.With(slog.String("snapshot_id", event.CorrelationID), slog.Int("batch", event.Batch))
+
+	customers := make([]localModels.Customer, len(event.Customers))
+	for i, customer := range event.Customers {
+		customers[i] = mirror.Customer(customer, event.Timestamp)
+	}
+
+	if err := mirror.SaveCustomers(h.db.WithContext(ctx), customers...); err != nil {
+		logger.ErrorContext(ctx, "Error seeding customers from snapshot", slog.Any("error", err))
+		return err
+	}
+
+	logger.InfoContext(ctx, "Seeded customers from snapshot", slog.Int("customers", len(event.Customers)))
+	if event.Last {
+		logger.InfoContext(ctx, "Customer snapshot complete", slog.Int("total", event.Total))
+	}
+	return nil
+}
+
+// HandleOrderSnapshot handles an order.snapshot batch, adding the orders
+// missing from the local database and linking the products of those without
+// any. The stock they took is already accounted for, so it is left as it is.
+func (h *SnapshotEventHandlers) HandleOrderSnapshot(ctx context.Context, event localEvents.OrderSnapshotEvent) error {
+	logger := h.logger.With(slog.String("snapshot_id", event.CorrelationID), slog.Int("batch", event.Batch))
+
+	linked := 0
+	err := h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		orders := make([]localModels.Order, len(event.Orders))
+		for i, snapshot := range event.Orders {
+			orders[i] = mirror.Order(snapshot.OrderID, snapshot.CustomerID, event.Timestamp)
+		}
+		if err := mirror.SaveOrders(tx, orders...); err != nil {
+			return err
+		}
+
+		for _, snapshot := range event.Orders {
+			if len(snapshot.ProductIDs) == 0 {
+				continue
+			}
+
+			// Orders already linked keep their products
+			var count int64
+			if err := tx.Model(&localModels.OrderProduct{}).Where("order_id = ?", snapshot.OrderID).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				continue
+			}
+
+			// Products unknown here cannot be linked
+			var known []uint
+			if err := tx.Unscoped().Model(&localModels.Product{}).Where("id IN ?", snapshot.ProductIDs).Pluck("id", &known).Error; err != nil {
+				return err
+			}
+
+			var orderProducts []localModels.OrderProduct
+			for _, productID := range snapshot.ProductIDs {
+				if slices.Contains(known, productID) {
+					orderProducts = append(orderProducts, localModels.OrderProduct{OrderID: snapshot.OrderID, ProductID: productID})
+				}
+			}
+			if len(orderProducts) > 0 {
+				if err := tx.Create(&orderProducts).Error; err != nil {
+					return err
+				}
+				linked++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.ErrorContext(ctx, "Error seeding orders from snapshot", slog.Any("error", err))
+		return err
+	}
+
+	logger.InfoContext(ctx, "Seeded orders from snapshot", slog.Int("orders", len(event.Orders)), slog.Int("linked", linked))
+	if event.Last {
+		logger.InfoContext(ctx, "Order snapshot complete", slog.Int("total", event.Total))
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package event_handlers_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	localEvents "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/events"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/logging"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/rabbitmq/event_handlers"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func setupMockDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	dbMock, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: dbMock,
+	}), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open gorm DB: %v", err)
+	}
+
+	return gormDB, mock
+}
+
+func TestHandleProductSnapshotRequested(t *testing.T) {
+	db, mock := setupMockDB(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "products" WHERE "products"."deleted_at" IS NULL ORDER BY "products"."id" LIMIT $1`)).
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "Arabica").AddRow(2, "Robusta"))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "products" WHERE "products"."id" > $1 AND "products"."deleted_at" IS NULL ORDER BY "products"."id" LIMIT $2`)).
+		WithArgs(2, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(3, "Moka"))
+
+	var published []localEvents.ProductSnapshotEvent
+	var correlationIDs []string
+	handlers := event_handlers.NewSnapshotEventHandlers(db, slog.New(slog.NewTextHandler(io.Discard, nil)), 100,
+		func(ctx context.Context, event localEvents.ProductSnapshotEvent) error {
+			published = append(published, event)
+			correlationIDs = append(correlationIDs, logging.CorrelationID(ctx))
+			return nil
+		})
+
+	err := handlers.HandleProductSnapshotRequested(context.Background(), localEvents.SnapshotRequest{CorrelationID: "snap-1", BatchSize: 2})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(published) != 2 {
+		t.Fatalf("expected 2 batches, got %d", len(published))
+	}
+	first, last := published[0], published[1]
+	if first.Batch != 1 || first.Last || len(first.Products) != 2 {
+		t.Errorf("unexpected first batch %+v", first.Snapshot)
+	}
+	if last.Batch != 2 || !last.Last || last.Total != 3 || len(last.Products) != 1 || last.Products[0].Name != "Moka" {
+		t.Errorf("unexpected last batch %+v", last.Snapshot)
+	}
+	for _, event := range published {
+		if event.CorrelationID != "snap-1" {
+			t.Errorf("expected the correlation ID of the request, got %q", event.CorrelationID)
+		}
+	}
+	if correlationIDs[0] != "snap-1" {
+		t.Errorf("expected the request correlation ID in the context, got %q", correlationIDs[0])
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled sqlmock expectations: %v", err)
+	}
+}
+
+func TestHandleProductSnapshotRequestedEmptyCatalogue(t *testing.T) {
+	db, mock := setupMockDB(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "products"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}))
+
+	var published []localEvents.ProductSnapshotEvent
+	handlers := event_handlers.NewSnapshotEventHandlers(db, slog.New(slog.NewTextHandler(io.Discard, nil)), 100,
+		func(ctx context.Context, event localEvents.ProductSnapshotEvent) error {
+			published = append(published, event)
+			return nil
+		})
+
+	if err := handlers.HandleProductSnapshotRequested(context.Background(), localEvents.SnapshotRequest{CorrelationID: "snap-2"}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// The completion marker is sent even without products
+	if len(published) != 1 || !published[0].Last || published[0].Total != 0 || published[0].Products == nil {
+		t.Errorf("expected a single empty last batch, got %+v", published)
+	}
+}
@@ -3,55 +3,284 @@ package rabbitmq
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/PayeTonKawa-EPSI-2025/Common-V2/events"
 	"github.com/PayeTonKawa-EPSI-2025/Common-V2/models"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/config"
+	localEvents "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/events"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/logging"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/metrics"
+	localModels "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/models"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/tracing"
 	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// CorrelationIDHeader is the AMQP header carrying the correlation ID, next to
+// the CorrelationId message property
+const CorrelationIDHeader = "x-correlation-id"
+
+// OriginHeader is the AMQP header carrying the CloudEvents source of the
+// publisher, whatever the CloudEvents mode, so the service recognizes its own
+// events when it consumes them
+const OriginHeader = "x-origin"
+
+// ErrPublisherClosed is returned by publishes made after Close
+var ErrPublisherClosed = errors.New("publisher closed")
+
+// Publisher publishes the events of this service on the events exchange
+type Publisher struct {
+	ch     *amqp.Channel
+	cfg    config.RabbitMQ
+	logger *slog.Logger
+	// archive records the published messages when set
+	archive *EventArchive
+
+	mu       sync.RWMutex
+	closed   bool
+	inFlight sync.WaitGroup
+}
+
+// NewPublisher creates a publisher; a nil channel disables publishing
+func NewPublisher(ch *amqp.Channel, cfg config.RabbitMQ, logger *slog.Logger) *Publisher {
+	return &Publisher{ch: ch, cfg: cfg, logger: logger}
+}
+
+// UseArchive records every message published from now on in the archive
+func (p *Publisher) UseArchive(archive *EventArchive) {
+	p.archive = archive
+}
+
+// Close stops accepting publishes and waits for the ones in flight, or for
+// ctx to expire
+func (p *Publisher) Close(ctx context.Context) error {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.inFlight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("publishes still in flight: %w", ctx.Err())
+	}
+}
+
+// begin registers a publish in flight, failing once the publisher is closed
+func (p *Publisher) begin() error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrPublisherClosed
+	}
+	p.inFlight.Add(1)
+	return nil
+}
+
+// productEventMessage adds the correlation ID of the originating request or
+// message to the shared product event
+type productEventMessage struct {
+	SchemaVersion int `json:"schemaVersion"`
+	events.ProductEvent
+	CorrelationID string `json:"correlationId,omitempty"`
+}
+
 // PublishProductEvent publishes a product event to RabbitMQ
-func PublishProductEvent(ch *amqp.Channel, eventType events.EventType, product models.Product) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+func (p *Publisher) PublishProductEvent(ctx context.Context, eventType events.EventType, product models.Product) error {
+	event := productEventMessage{
+		SchemaVersion: localEvents.PublishedSchemaVersion,
+		ProductEvent: events.ProductEvent{
+			Type:      eventType,
+			Product:   product,
+			Timestamp: time.Now(),
+		},
+		CorrelationID: logging.CorrelationID(ctx),
+	}
 
-	event := events.ProductEvent{
-		Type:      eventType,
-		Product:   product,
-		Timestamp: time.Now(),
+	if err := p.publish(ctx, eventType, productSubject(product.ID), event); err != nil {
+		return err
 	}
 
+	p.logger.InfoContext(ctx, "Published product event",
+		slog.String("event_type", string(eventType)),
+		slog.Uint64("product_id", uint64(product.ID)),
+	)
+	return nil
+}
+
+// PublishStockEvent publishes a low-stock or out-of-stock alert to RabbitMQ
+func (p *Publisher) PublishStockEvent(ctx context.Context, eventType events.EventType, product localModels.Product) error {
+	event := localEvents.StockEvent{
+		SchemaVersion:    localEvents.PublishedSchemaVersion,
+		Type:             eventType,
+		Product:          product.Product,
+		ReorderThreshold: product.ReorderThreshold,
+		Timestamp:        time.Now(),
+		CorrelationID:    logging.CorrelationID(ctx),
+	}
+
+	if err := p.publish(ctx, eventType, productSubject(product.ID), event); err != nil {
+		return err
+	}
+
+	p.logger.InfoContext(ctx, "Published stock event",
+		slog.String("event_type", string(eventType)),
+		slog.Uint64("product_id", uint64(product.ID)),
+		slog.Uint64("stock", uint64(product.Stock)),
+	)
+	return nil
+}
+
+// PublishSnapshotRequest asks the service owning an entity for a snapshot,
+// returning the correlation ID of the snapshot events answering it
+func (p *Publisher) PublishSnapshotRequest(ctx context.Context, eventType events.EventType) (string, error) {
+	correlationID := logging.NewCorrelationID()
+	ctx = logging.WithCorrelationID(ctx, correlationID)
+
+	event := localEvents.SnapshotRequest{
+		SchemaVersion: localEvents.PublishedSchemaVersion,
+		Type:          eventType,
+		CorrelationID: correlationID,
+		Timestamp:     time.Now(),
+	}
+
+	if err := p.publish(ctx, eventType, "", event); err != nil {
+		return "", err
+	}
+
+	p.logger.InfoContext(ctx, "Requested snapshot", slog.String("event_type", string(eventType)))
+	return correlationID, nil
+}
+
+// PublishProductSnapshot publishes one batch of a product snapshot
+func (p *Publisher) PublishProductSnapshot(ctx context.Context, event localEvents.ProductSnapshotEvent) error {
+	event.SchemaVersion = localEvents.PublishedSchemaVersion
+	event.Type = localEvents.ProductSnapshot
+	event.Timestamp = time.Now()
+
+	if err := p.publish(ctx, localEvents.ProductSnapshot, "", event); err != nil {
+		return err
+	}
+
+	p.logger.DebugContext(ctx, "Published product snapshot batch",
+		slog.Int("batch", event.Batch),
+		slog.Int("products", len(event.Products)),
+		slog.Bool("last", event.Last),
+	)
+	return nil
+}
+
+// productSubject is the CloudEvents subject of the events about a product
+func productSubject(id uint) string {
+	return "product/" + strconv.FormatUint(uint64(id), 10)
+}
+
+// publish marshals an event and publishes it on the events exchange,
+// using the event type as routing key and propagating the correlation ID
+// and trace context. The subject names the entity for CloudEvents.
+func (p *Publisher) publish(ctx context.Context, eventType events.EventType, subject string, event any) (err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "publish "+string(eventType),
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "rabbitmq"),
+			attribute.String("messaging.destination.name", p.cfg.Exchange),
+			attribute.String("messaging.rabbitmq.destination.routing_key", string(eventType)),
+		),
+	)
+	defer func() {
+		if err != nil {
+			tracing.RecordError(span, err)
+		}
+		span.End()
+		if p.ch != nil {
+			metrics.EventPublished(string(eventType), err)
+		}
+	}()
+
+	correlationID := logging.CorrelationID(ctx)
+
 	body, err := json.Marshal(event)
 	if err != nil {
-		log.Printf("Error marshaling event: %v", err)
+		p.logger.ErrorContext(ctx, "Error marshaling event", slog.Any("error", err))
+		return err
+	}
+
+	if p.ch == nil {
+		p.logger.DebugContext(ctx, "RabbitMQ disabled: skipping event publish", slog.String("event_type", string(eventType)))
+		return nil
+	}
+
+	if err := p.begin(); err != nil {
 		return err
 	}
+	defer p.inFlight.Done()
+
+	ctx, cancel := context.WithTimeout(ctx, p.cfg.PublishTimeout)
+	defer cancel()
 
 	// Use a routing key based on the event type
 	routingKey := string(eventType)
 
-	if ch != nil {
-		err = ch.PublishWithContext(
-			ctx,
-			"events", // exchange
-			routingKey,
-			false, // mandatory
-			false, // immediate
-			amqp.Publishing{
-				ContentType: "application/json",
-				Body:        body,
-			},
-		)
-	} else {
-		log.Println("RabbitMQ disabled: skipping event publish")
+	msg := amqp.Publishing{
+		ContentType:   "application/json",
+		MessageId:     logging.NewCorrelationID(),
+		CorrelationId: correlationID,
+		Timestamp:     time.Now(),
+		Body:          body,
+		Headers:       tracing.InjectAMQP(ctx, nil),
+	}
+	msg.Headers[localEvents.SchemaVersionHeader] = int32(localEvents.PublishedSchemaVersion)
+	if correlationID != "" {
+		msg.Headers[CorrelationIDHeader] = correlationID
+	}
+	if p.cfg.CloudEventsSource != "" {
+		msg.Headers[OriginHeader] = p.cfg.CloudEventsSource
+	}
+	if err := encodeCloudEvent(&msg, p.cfg.CloudEvents, p.cfg.CloudEventsSource, routingKey, subject); err != nil {
+		return err
 	}
 
+	start := time.Now()
+	err = p.ch.PublishWithContext(
+		ctx,
+		p.cfg.Exchange,
+		routingKey,
+		false, // mandatory
+		false, // immediate
+		msg,
+	)
+	if p.archive != nil {
+		// Archive the event itself, not its CloudEvents envelope
+		p.archive.Record(ctx, ArchivePublished, localEvents.Delivery{
+			Exchange:      p.cfg.Exchange,
+			RoutingKey:    routingKey,
+			MessageID:     msg.MessageId,
+			CorrelationID: correlationID,
+			Timestamp:     msg.Timestamp,
+			Headers:       msg.Headers,
+			Body:          body,
+		}, err, time.Since(start))
+	}
 	if err != nil {
-		log.Printf("Error publishing message: %v", err)
+		p.logger.ErrorContext(ctx, "Error publishing message",
+			slog.String("event_type", string(eventType)),
+			slog.Any("error", err),
+		)
 		return err
 	}
 
-	log.Printf("Published %s event for product %d", eventType, product.ID)
 	return nil
 }
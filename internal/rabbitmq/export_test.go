@@ -0,0 +1,34 @@
+package rabbitmq
+
+import (
+	"context"
+	"sync"
+
+	localEvents "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/events"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Consume starts a consumer of msgs, closing it when the consumer is
+// stopped as the broker does
+func (r *EventRouter) Consume(msgs chan amqp.Delivery, workers int) *Consumer {
+	var once sync.Once
+	return r.consume(msgs, "test", workers, len(msgs), func() error {
+		once.Do(func() { close(msgs) })
+		return nil
+	})
+}
+
+// Dispatch handles msgs with a pool of workers until it is closed
+func (r *EventRouter) Dispatch(ctx context.Context, msgs <-chan amqp.Delivery, workers int) {
+	r.dispatch(ctx, msgs, workers, 0)
+}
+
+// EncodeCloudEvent turns a plain JSON publishing into a CloudEvent
+func EncodeCloudEvent(msg *amqp.Publishing, mode, source, eventType, subject string) error {
+	return encodeCloudEvent(msg, mode, source, eventType, subject)
+}
+
+// DecodeDelivery returns what handlers receive of a delivery
+func DecodeDelivery(d amqp.Delivery) (localEvents.Delivery, error) {
+	return newDelivery(d)
+}
@@ -0,0 +1,242 @@
+package rabbitmq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"time"
+
+	localEvents "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/events"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/logging"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/metrics"
+	localModels "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/models"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/tracing"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Middleware wraps the handling of a message with cross-cutting behavior
+type Middleware func(next EventHandler) EventHandler
+
+// Use adds middleware around the handlers of every message. The first one
+// added is the outermost.
+func (r *EventRouter) Use(middleware ...Middleware) {
+	r.middleware = append(r.middleware, middleware...)
+}
+
+// chain wraps a handler with the middleware of the router
+func (r *EventRouter) chain(handler EventHandler) EventHandler {
+	for i := len(r.middleware) - 1; i >= 0; i-- {
+		handler = r.middleware[i](handler)
+	}
+	return handler
+}
+
+// Register registers a handler receiving the message body decoded as T
+func Register[T any](r *EventRouter, pattern string, handler func(ctx context.Context, event T) error, opts ...HandlerOption) {
+	r.RegisterHandler(pattern, Decode(handler), opts...)
+}
+
+// Decode adapts a handler of decoded events to an EventHandler
+func Decode[T any](handler func(ctx context.Context, event T) error) EventHandler {
+	return func(ctx context.Context, delivery localEvents.Delivery) error {
+		var event T
+		if err := json.Unmarshal(delivery.Body, &event); err != nil {
+			return fmt.Errorf("decoding %s event: %w", delivery.RoutingKey, err)
+		}
+		return handler(ctx, event)
+	}
+}
+
+// Validate checks the body of each message against the schema of its routing
+// key, handing the handlers the body upcast to the current version. Invalid
+// messages fail with events.ErrInvalidEvent, which the router rejects.
+func Validate(registry *localEvents.SchemaRegistry) Middleware {
+	return func(next EventHandler) EventHandler {
+		return func(ctx context.Context, delivery localEvents.Delivery) error {
+			version, err := localEvents.SchemaVersion(delivery.Headers, delivery.Body)
+			if err != nil {
+				return err
+			}
+			if delivery.Body, err = registry.Check(delivery.RoutingKey, version, delivery.Body); err != nil {
+				return err
+			}
+			return next(ctx, delivery)
+		}
+	}
+}
+
+// Tracing handles each message in a consumer span continuing the trace of
+// the publisher when the message carries one
+func Tracing() Middleware {
+	return func(next EventHandler) EventHandler {
+		return func(ctx context.Context, delivery localEvents.Delivery) error {
+			ctx, span := tracing.Tracer().Start(tracing.ExtractAMQP(ctx, amqp.Table(delivery.Headers)), "process "+delivery.RoutingKey,
+				trace.WithSpanKind(trace.SpanKindConsumer),
+				trace.WithAttributes(
+					attribute.String("messaging.system", "rabbitmq"),
+					attribute.String("messaging.destination.name", delivery.Exchange),
+					attribute.String("messaging.rabbitmq.destination.routing_key", delivery.RoutingKey),
+					attribute.String("messaging.message.id", delivery.MessageID),
+				),
+			)
+			defer span.End()
+
+			err := next(ctx, delivery)
+			if err != nil {
+				tracing.RecordError(span, err)
+			}
+			return err
+		}
+	}
+}
+
+// Logging logs each message received and the errors of its handlers
+func Logging() Middleware {
+	return func(next EventHandler) EventHandler {
+		return func(ctx context.Context, delivery localEvents.Delivery) error {
+			logger := logging.FromContext(ctx)
+			logger.InfoContext(ctx, "Received message")
+
+			start := time.Now()
+			err := next(ctx, delivery)
+			if err != nil {
+				logger.ErrorContext(ctx, "Error processing message", slog.Any("error", err))
+				return err
+			}
+			logger.DebugContext(ctx, "Processed message", slog.Duration("duration", time.Since(start)))
+			return nil
+		}
+	}
+}
+
+// Metrics records the duration and outcome of each message
+func Metrics() Middleware {
+	return func(next EventHandler) EventHandler {
+		return func(ctx context.Context, delivery localEvents.Delivery) error {
+			start := time.Now()
+			err := next(ctx, delivery)
+			metrics.EventHandled(delivery.RoutingKey, time.Since(start), err)
+			return err
+		}
+	}
+}
+
+// PanicError is the error of a handler that panicked
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("handler panicked: %v", e.Value)
+}
+
+// Recover turns a panic of a handler into a *PanicError, so the middleware
+// around it sees the failure. The router rejects such messages.
+func Recover() Middleware {
+	return func(next EventHandler) EventHandler {
+		return func(ctx context.Context, delivery localEvents.Delivery) (err error) {
+			defer func() {
+				if p := recover(); p != nil {
+					err = &PanicError{Value: p, Stack: debug.Stack()}
+				}
+			}()
+			return next(ctx, delivery)
+		}
+	}
+}
+
+// Timeout cancels the context of the handler after timeout and reports the
+// timeout in its error
+func Timeout(timeout time.Duration) Middleware {
+	return func(next EventHandler) EventHandler {
+		return func(ctx context.Context, delivery localEvents.Delivery) error {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			err := next(ctx, delivery)
+			if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				err = fmt.Errorf("handler timed out after %s: %w", timeout, err)
+			}
+			return err
+		}
+	}
+}
+
+// IdempotencyStore remembers the messages handled successfully
+type IdempotencyStore interface {
+	Processed(ctx context.Context, messageID string) (bool, error)
+	MarkProcessed(ctx context.Context, messageID, routingKey string) error
+}
+
+type skipIdempotencyKey struct{}
+
+// withoutIdempotency marks the context of a message only handlers registered
+// WithoutIdempotency receive
+func withoutIdempotency(ctx context.Context) context.Context {
+	return context.WithValue(ctx, skipIdempotencyKey{}, true)
+}
+
+// Idempotent skips the messages the store has already seen processed.
+// Messages without a message ID are always handled, and replayed messages
+// are handled again. Messages only handlers registered WithoutIdempotency
+// receive are neither checked nor recorded.
+func Idempotent(store IdempotencyStore) Middleware {
+	return func(next EventHandler) EventHandler {
+		return func(ctx context.Context, delivery localEvents.Delivery) error {
+			if skip, _ := ctx.Value(skipIdempotencyKey{}).(bool); skip || delivery.MessageID == "" {
+				return next(ctx, delivery)
+			}
+
+			if !IsReplay(ctx) {
+				processed, err := store.Processed(ctx, delivery.MessageID)
+				if err != nil {
+					return fmt.Errorf("checking processed messages: %w", err)
+				}
+				if processed {
+					logging.FromContext(ctx).InfoContext(ctx, "Skipping message already processed", slog.String("message_id", delivery.MessageID))
+					return nil
+				}
+			}
+
+			if err := next(ctx, delivery); err != nil {
+				return err
+			}
+			return store.MarkProcessed(ctx, delivery.MessageID, delivery.RoutingKey)
+		}
+	}
+}
+
+// ProcessedMessageStore is an IdempotencyStore backed by the
+// processed_messages table
+type ProcessedMessageStore struct {
+	db *gorm.DB
+}
+
+// NewProcessedMessageStore creates a store on the database
+func NewProcessedMessageStore(db *gorm.DB) *ProcessedMessageStore {
+	return &ProcessedMessageStore{db: db}
+}
+
+// Processed implements IdempotencyStore
+func (s *ProcessedMessageStore) Processed(ctx context.Context, messageID string) (bool, error) {
+	var count int64
+	err := s.db.WithContext(ctx).Model(&localModels.ProcessedMessage{}).Where("message_id = ?", messageID).Count(&count).Error
+	return count > 0, err
+}
+
+// MarkProcessed implements IdempotencyStore
+func (s *ProcessedMessageStore) MarkProcessed(ctx context.Context, messageID, routingKey string) error {
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&localModels.ProcessedMessage{
+		MessageID:   messageID,
+		RoutingKey:  routingKey,
+		ProcessedAt: time.Now(),
+	}).Error
+}
@@ -0,0 +1,115 @@
+package rabbitmq_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PayeTonKawa-EPSI-2025/Common-V2/events"
+	localEvents "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/events"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/rabbitmq"
+)
+
+func TestDecode(t *testing.T) {
+	var got events.OrderEvent
+	handler := rabbitmq.Decode(func(ctx context.Context, event events.OrderEvent) error {
+		got = event
+		return nil
+	})
+
+	err := handler(context.Background(), localEvents.Delivery{
+		RoutingKey: "order.created",
+		Body:       []byte(`{"type":"order.created","order":{"orderId":42,"productIds":[1,2]}}`),
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got.Order.OrderID != 42 || len(got.Order.ProductIDs) != 2 {
+		t.Errorf("expected the decoded order, got %+v", got)
+	}
+
+	err = handler(context.Background(), localEvents.Delivery{RoutingKey: "order.created", Body: []byte(`not json`)})
+	if err == nil || !strings.Contains(err.Error(), "decoding order.created event") {
+		t.Errorf("expected a decoding error, got %v", err)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	handler := rabbitmq.Recover()(func(ctx context.Context, delivery localEvents.Delivery) error {
+		var db *struct{ name string }
+		_ = db.name
+		return nil
+	})
+
+	err := handler(context.Background(), localEvents.Delivery{})
+	var panicErr *rabbitmq.PanicError
+	if !errors.As(err, &panicErr) {
+		t.Fatalf("expected a panic error, got %v", err)
+	}
+	if !strings.Contains(string(panicErr.Stack), "TestRecover") {
+		t.Errorf("expected the stack of the panic, got %s", panicErr.Stack)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	handler := rabbitmq.Timeout(10 * time.Millisecond)(func(ctx context.Context, delivery localEvents.Delivery) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	err := handler(context.Background(), localEvents.Delivery{})
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "timed out after 10ms") {
+		t.Errorf("expected a timeout error, got %v", err)
+	}
+}
+
+type memoryStore map[string]string
+
+func (s memoryStore) Processed(ctx context.Context, messageID string) (bool, error) {
+	_, ok := s[messageID]
+	return ok, nil
+}
+
+func (s memoryStore) MarkProcessed(ctx context.Context, messageID, routingKey string) error {
+	s[messageID] = routingKey
+	return nil
+}
+
+func TestIdempotent(t *testing.T) {
+	store := memoryStore{}
+	calls := 0
+	fail := true
+	handler := rabbitmq.Idempotent(store)(func(ctx context.Context, delivery localEvents.Delivery) error {
+		calls++
+		if fail {
+			return errors.New("database down")
+		}
+		return nil
+	})
+
+	delivery := localEvents.Delivery{MessageID: "m1", RoutingKey: "order.created"}
+
+	// A failed message is not marked, so its redelivery is handled again
+	if err := handler(context.Background(), delivery); err == nil {
+		t.Fatal("expected the handler error")
+	}
+	fail = false
+	for range 2 {
+		if err := handler(context.Background(), delivery); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("expected the duplicate to be skipped, got %d calls", calls)
+	}
+
+	// Messages without an ID cannot be deduplicated
+	for range 2 {
+		_ = handler(context.Background(), localEvents.Delivery{RoutingKey: "order.created"})
+	}
+	if calls != 4 {
+		t.Errorf("expected messages without ID to be handled, got %d calls", calls)
+	}
+}
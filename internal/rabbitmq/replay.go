@@ -0,0 +1,159 @@
+package rabbitmq
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	localEvents "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/events"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/logging"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+type replayKey struct{}
+
+// WithReplay marks the context of a message handled again by a replay
+func WithReplay(ctx context.Context) context.Context {
+	return context.WithValue(ctx, replayKey{}, true)
+}
+
+// IsReplay reports whether the message is being replayed
+func IsReplay(ctx context.Context) bool {
+	ok, _ := ctx.Value(replayKey{}).(bool)
+	return ok
+}
+
+// ReplayOptions selects the messages to replay
+type ReplayOptions struct {
+	// From and To bound the publication time of the messages, To excluded.
+	// Messages without a timestamp are skipped when either is set.
+	From, To time.Time
+	// DryRun only counts the messages that would be replayed
+	DryRun bool
+}
+
+// includes reports whether a message published at timestamp is in range
+func (o ReplayOptions) includes(timestamp time.Time) bool {
+	if o.From.IsZero() && o.To.IsZero() {
+		return true
+	}
+	if timestamp.IsZero() {
+		return false
+	}
+	return !timestamp.Before(o.From) && (o.To.IsZero() || timestamp.Before(o.To))
+}
+
+// ReplayResult counts the messages of a replay
+type ReplayResult struct {
+	Read       int            `json:"read"`
+	OutOfRange int            `json:"outOfRange"`
+	Unhandled  int            `json:"unhandled"`
+	Replayed   int            `json:"replayed"`
+	Failed     int            `json:"failed"`
+	ByKey      map[string]int `json:"byRoutingKey"`
+}
+
+// Replay hands a message to its handlers again, outside of any queue. The
+// handlers see IsReplay in their context.
+func (r *EventRouter) Replay(ctx context.Context, delivery localEvents.Delivery, opts ReplayOptions, result *ReplayResult) {
+	if result.ByKey == nil {
+		result.ByKey = make(map[string]int)
+	}
+	result.Read++
+
+	if !opts.includes(delivery.Timestamp) {
+		result.OutOfRange++
+		return
+	}
+	if _, ok := r.find(delivery.RoutingKey); !ok {
+		result.Unhandled++
+		return
+	}
+	result.ByKey[delivery.RoutingKey]++
+	if opts.DryRun {
+		result.Replayed++
+		return
+	}
+
+	if delivery.CorrelationID == "" {
+		delivery.CorrelationID = logging.NewCorrelationID()
+	}
+	ctx = logging.WithCorrelationID(WithReplay(ctx), delivery.CorrelationID)
+	ctx = logging.WithLogger(ctx, r.logger.With(slog.String("routing_key", delivery.RoutingKey)))
+
+	if err := r.process(ctx, delivery); err != nil {
+		result.Failed++
+		return
+	}
+	result.Replayed++
+}
+
+// ReplayArchive replays the messages of an NDJSON archive, one
+// events.ArchivedMessage per line
+func (r *EventRouter) ReplayArchive(ctx context.Context, archive io.Reader, opts ReplayOptions) (ReplayResult, error) {
+	var result ReplayResult
+
+	scanner := bufio.NewScanner(archive)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var message localEvents.ArchivedMessage
+		if err := json.Unmarshal(scanner.Bytes(), &message); err != nil {
+			return result, fmt.Errorf("line %d: %w", line, err)
+		}
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		r.Replay(ctx, message.Delivery(), opts, &result)
+	}
+	return result, scanner.Err()
+}
+
+// ReplayQueue replays the messages waiting in a queue until it is empty.
+// Replayed messages are acknowledged; in a dry run, every message is
+// requeued at the end.
+func (r *EventRouter) ReplayQueue(ctx context.Context, ch *amqp.Channel, queue string, opts ReplayOptions) (ReplayResult, error) {
+	var result ReplayResult
+	var last uint64
+
+	for ctx.Err() == nil {
+		d, ok, err := ch.Get(queue, false)
+		if err != nil {
+			return result, err
+		}
+		if !ok {
+			break
+		}
+		last = d.DeliveryTag
+
+		delivery, err := newDelivery(d)
+		if err != nil {
+			result.Read++
+			result.Failed++
+			r.logger.Warn("Skipping undecodable message", slog.Any("error", err))
+			continue
+		}
+
+		failed := result.Failed
+		r.Replay(ctx, delivery, opts, &result)
+		if !opts.DryRun && result.Failed == failed {
+			if err := d.Ack(false); err != nil {
+				return result, err
+			}
+		}
+	}
+
+	// Failed messages, and every message of a dry run, go back to the queue
+	if last != 0 {
+		if err := ch.Nack(last, true, true); err != nil {
+			return result, err
+		}
+	}
+	return result, ctx.Err()
+}
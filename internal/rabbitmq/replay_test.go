@@ -0,0 +1,85 @@
+package rabbitmq_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	localEvents "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/events"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/rabbitmq"
+)
+
+const archive = `{"routingKey":"order.created","messageId":"m1","timestamp":"2025-03-01T10:00:00Z","body":{"type":"order.created","order":{"orderId":1}}}
+{"routingKey":"order.created","messageId":"m2","timestamp":"2025-03-02T10:00:00Z","body":{"type":"order.created","order":{"orderId":2}}}
+
+{"routingKey":"customer.created","messageId":"m3","timestamp":"2025-03-03T10:00:00Z","body":{"type":"customer.created","customer":{"ID":3}}}
+{"routingKey":"order.created","messageId":"m4","body":{"type":"order.created","order":{"orderId":4}}}
+`
+
+func newReplayRouter(handled *[]string) *rabbitmq.EventRouter {
+	router := rabbitmq.NewEventRouter(slog.New(slog.NewTextHandler(io.Discard, nil)), time.Second)
+	store := memoryStore{"m1": "order.created"}
+	router.Use(rabbitmq.Idempotent(store))
+	router.RegisterHandler("order.*", func(ctx context.Context, delivery localEvents.Delivery) error {
+		if !rabbitmq.IsReplay(ctx) || !delivery.Redelivered {
+			return nil
+		}
+		*handled = append(*handled, delivery.MessageID)
+		return nil
+	})
+	return router
+}
+
+func TestReplayArchive(t *testing.T) {
+	var handled []string
+	router := newReplayRouter(&handled)
+
+	result, err := router.ReplayArchive(context.Background(), strings.NewReader(archive), rabbitmq.ReplayOptions{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// Already processed messages are handled again
+	if strings.Join(handled, ",") != "m1,m2,m4" {
+		t.Errorf("expected every order event to be replayed, got %v", handled)
+	}
+	if result.Read != 4 || result.Replayed != 3 || result.Unhandled != 1 || result.ByKey["order.created"] != 3 {
+		t.Errorf("unexpected result %+v", result)
+	}
+}
+
+func TestReplayArchiveOptions(t *testing.T) {
+	var handled []string
+	router := newReplayRouter(&handled)
+
+	opts := rabbitmq.ReplayOptions{
+		From: time.Date(2025, 3, 2, 0, 0, 0, 0, time.UTC),
+		To:   time.Date(2025, 3, 3, 10, 0, 0, 0, time.UTC),
+	}
+	result, err := router.ReplayArchive(context.Background(), strings.NewReader(archive), opts)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if strings.Join(handled, ",") != "m2" || result.OutOfRange != 3 {
+		t.Errorf("expected only the events in range, got %v and %+v", handled, result)
+	}
+
+	// A dry run counts without handling
+	handled = nil
+	opts.DryRun = true
+	result, err = router.ReplayArchive(context.Background(), strings.NewReader(archive), opts)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(handled) != 0 || result.Replayed != 1 {
+		t.Errorf("expected a dry run, got %v and %+v", handled, result)
+	}
+
+	_, err = router.ReplayArchive(context.Background(), strings.NewReader("{\n"), rabbitmq.ReplayOptions{})
+	if err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("expected the malformed line, got %v", err)
+	}
+}
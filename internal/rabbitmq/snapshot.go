@@ -0,0 +1,35 @@
+package rabbitmq
+
+import (
+	"context"
+
+	"github.com/PayeTonKawa-EPSI-2025/Common-V2/events"
+	localEvents "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/events"
+	localModels "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/models"
+	"gorm.io/gorm"
+)
+
+// RequestSnapshots requests the customer and order snapshots seeding the
+// local tables that are empty, deleted rows included
+func RequestSnapshots(ctx context.Context, db *gorm.DB, publisher *Publisher) error {
+	for _, seed := range []struct {
+		model     any
+		eventType events.EventType
+	}{
+		{&localModels.Customer{}, localEvents.CustomerSnapshotRequested},
+		{&localModels.Order{}, localEvents.OrderSnapshotRequested},
+	} {
+		var ids []uint
+		if err := db.WithContext(ctx).Unscoped().Model(seed.model).Limit(1).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		if len(ids) > 0 {
+			continue
+		}
+
+		if _, err := publisher.PublishSnapshotRequest(ctx, seed.eventType); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package rabbitmq
+
+import (
+	"sort"
+	"strings"
+)
+
+// MatchTopic reports whether a routing key matches a binding pattern with the
+// semantics of an AMQP topic exchange: words are separated by dots, `*`
+// matches exactly one word and `#` matches zero or more words
+func MatchTopic(pattern, routingKey string) bool {
+	return matchWords(strings.Split(pattern, "."), strings.Split(routingKey, "."))
+}
+
+func matchWords(pattern, key []string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case "#":
+			// Collapse consecutive #, then try every number of words for it
+			for len(pattern) > 0 && pattern[0] == "#" {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(key); i++ {
+				if matchWords(pattern, key[i:]) {
+					return true
+				}
+			}
+			return false
+		case "*":
+			if len(key) == 0 {
+				return false
+			}
+		default:
+			if len(key) == 0 || pattern[0] != key[0] {
+				return false
+			}
+		}
+		pattern, key = pattern[1:], key[1:]
+	}
+	return len(key) == 0
+}
+
+// specificity ranks a pattern: literal words count most, then `*`, while `#`
+// counts against it as it matches the most keys
+func specificity(pattern string) (literals, singles, multis int) {
+	for _, word := range strings.Split(pattern, ".") {
+		switch word {
+		case "#":
+			multis++
+		case "*":
+			singles++
+		default:
+			literals++
+		}
+	}
+	return literals, singles, multis
+}
+
+// sortBySpecificity orders patterns from the most to the least specific,
+// alphabetically when they rank the same so dispatch is deterministic
+func sortBySpecificity(patterns []string) {
+	sort.SliceStable(patterns, func(i, j int) bool {
+		li, si, mi := specificity(patterns[i])
+		lj, sj, mj := specificity(patterns[j])
+		switch {
+		case li != lj:
+			return li > lj
+		case mi != mj:
+			return mi < mj
+		case si != sj:
+			return si > sj
+		}
+		return patterns[i] < patterns[j]
+	})
+}
@@ -0,0 +1,60 @@
+package rabbitmq_test
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"testing"
+
+	localEvents "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/events"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/rabbitmq"
+)
+
+func TestMatchTopic(t *testing.T) {
+	tests := []struct {
+		pattern    string
+		routingKey string
+		want       bool
+	}{
+		{"order.created", "order.created", true},
+		{"order.created", "order.updated", false},
+		{"order.*", "order.created", true},
+		{"order.*", "order", false},
+		{"order.*", "order.payment.failed", false},
+		{"*.deleted", "customer.deleted", true},
+		{"*.deleted", "deleted", false},
+		{"order.*.failed", "order.payment.failed", true},
+		{"order.*.failed", "order.failed", false},
+		{"order.#", "order", true},
+		{"order.#", "order.payment.failed", true},
+		{"#.failed", "order.payment.failed", true},
+		{"#.failed", "failed", true},
+		{"order.#.failed", "order.failed", true},
+		{"order.#.failed", "order.payment.retry.failed", true},
+		{"order.#.failed", "order.payment.succeeded", false},
+		{"#", "anything.at.all", true},
+		{"order*", "order.created", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.routingKey, func(t *testing.T) {
+			if got := rabbitmq.MatchTopic(tt.pattern, tt.routingKey); got != tt.want {
+				t.Errorf("MatchTopic(%q, %q) = %v, want %v", tt.pattern, tt.routingKey, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRouterPatternsBySpecificity(t *testing.T) {
+	router := rabbitmq.NewEventRouter(slog.Default(), 0)
+	noop := func(ctx context.Context, delivery localEvents.Delivery) error { return nil }
+
+	for _, pattern := range []string{"#", "order.#", "*.deleted", "order.created", "order.*", "customer.deleted", "order.created"} {
+		router.RegisterHandler(pattern, noop)
+	}
+
+	want := []string{"customer.deleted", "order.created", "*.deleted", "order.*", "order.#", "#"}
+	if got := router.Patterns(); !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
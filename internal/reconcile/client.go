@@ -0,0 +1,167 @@
+package reconcile
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/PayeTonKawa-EPSI-2025/Common-V2/models"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/logging"
+)
+
+// Order is an order as listed by the order service, one product ID per unit
+type Order struct {
+	ID         uint
+	CustomerID uint
+	ProductIDs []uint
+}
+
+// Client lists the customers and orders of the services owning them
+type Client struct {
+	http         *http.Client
+	customersURL string
+	ordersURL    string
+}
+
+// NewClient creates a client of the services at their base URLs
+func NewClient(httpClient *http.Client, customersURL, ordersURL string) *Client {
+	return &Client{
+		http:         httpClient,
+		customersURL: strings.TrimSuffix(customersURL, "/"),
+		ordersURL:    strings.TrimSuffix(ordersURL, "/"),
+	}
+}
+
+// Customers lists every customer of the customer service
+func (c *Client) Customers(ctx context.Context) ([]models.Customer, error) {
+	return list[models.Customer](ctx, c, c.customersURL+"/customers", "customers")
+}
+
+// upstreamOrder is an order of the order service, listing its products
+// either as product objects or as product IDs
+type upstreamOrder struct {
+	models.Order
+	ProductIDs []uint `json:"productIds"`
+}
+
+// Orders lists every order of the order service
+func (c *Client) Orders(ctx context.Context) ([]Order, error) {
+	upstream, err := list[upstreamOrder](ctx, c, c.ordersURL+"/orders", "orders")
+	if err != nil {
+		return nil, err
+	}
+
+	orders := make([]Order, len(upstream))
+	for i, o := range upstream {
+		orders[i] = Order{ID: o.ID, CustomerID: o.CustomerID, ProductIDs: o.ProductIDs}
+		if len(o.ProductIDs) == 0 {
+			for _, product := range o.Products {
+				orders[i].ProductIDs = append(orders[i].ProductIDs, product.ID)
+			}
+		}
+	}
+	return orders, nil
+}
+
+// list fetches every page of a list. Pages follow each other through a Link
+// header with rel="next", or a "next" URL next to the items.
+func list[T any](ctx context.Context, c *Client, url, key string) ([]T, error) {
+	var items []T
+	seen := map[string]bool{}
+	for next := url; next != ""; {
+		if seen[next] {
+			return nil, fmt.Errorf("GET %s: pagination loops back to %s", url, next)
+		}
+		seen[next] = true
+
+		var page []T
+		var err error
+		if next, err = c.page(ctx, next, key, &page); err != nil {
+			return nil, err
+		}
+		items = append(items, page...)
+	}
+	return items, nil
+}
+
+// page fetches a page of a list, returned either as a JSON array or wrapped
+// in an object under key as this service does, and returns the URL of the
+// next page, empty on the last one
+func (c *Client) page(ctx context.Context, pageURL, key string, items any) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/json")
+	if correlationID := logging.CorrelationID(ctx); logging.ValidCorrelationID(correlationID) {
+		req.Header.Set(logging.RequestIDHeader, correlationID)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("GET %s: %w", pageURL, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("GET %s: %w", pageURL, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("GET %s: unexpected status %s", pageURL, resp.Status)
+	}
+
+	next := nextLink(resp.Header.Values("Link"))
+	if trimmed := strings.TrimSpace(string(body)); strings.HasPrefix(trimmed, "{") {
+		var wrapped map[string]json.RawMessage
+		if err := json.Unmarshal(body, &wrapped); err != nil {
+			return "", fmt.Errorf("GET %s: %w", pageURL, err)
+		}
+		var ok bool
+		if body, ok = wrapped[key]; !ok {
+			return "", fmt.Errorf("GET %s: no %s in the response", pageURL, key)
+		}
+		if raw, ok := wrapped["next"]; ok && next == "" {
+			if err := json.Unmarshal(raw, &next); err != nil {
+				return "", fmt.Errorf("GET %s: decoding next: %w", pageURL, err)
+			}
+		}
+	}
+	if err := json.Unmarshal(body, items); err != nil {
+		return "", fmt.Errorf("GET %s: decoding %s: %w", pageURL, key, err)
+	}
+
+	if next == "" {
+		return "", nil
+	}
+	// The next page may be relative to this one
+	nextURL, err := req.URL.Parse(next)
+	if err != nil {
+		return "", fmt.Errorf("GET %s: next page %q: %w", pageURL, next, err)
+	}
+	return nextURL.String(), nil
+}
+
+// nextLink returns the target of the rel="next" link of Link headers
+func nextLink(headers []string) string {
+	for _, header := range headers {
+		for _, link := range strings.Split(header, ",") {
+			target, params, _ := strings.Cut(link, ";")
+			target = strings.TrimSpace(target)
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			for _, param := range strings.Split(params, ";") {
+				name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+				if strings.EqualFold(name, "rel") && slices.Contains(strings.Fields(strings.Trim(value, `"`)), "next") {
+					return strings.Trim(target, "<>")
+				}
+			}
+		}
+	}
+	return ""
+}
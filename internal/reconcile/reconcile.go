@@ -0,0 +1,449 @@
+// Package reconcile compares the local customers, orders and order products
+// with the services owning them, and optionally repairs the differences
+package reconcile
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/PayeTonKawa-EPSI-2025/Common-V2/events"
+	"github.com/PayeTonKawa-EPSI-2025/Common-V2/models"
+	localEvents "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/events"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/inventory"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/metrics"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/mirror"
+	localModels "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/models"
+	"gorm.io/gorm"
+)
+
+// Report lists the differences between the local mirrors and the services
+type Report struct {
+	// MissingCustomers exist upstream only, ExtraCustomers locally only
+	MissingCustomers []uint `json:"missingCustomers"`
+	ExtraCustomers   []uint `json:"extraCustomers"`
+	// MissingOrders exist upstream only, ExtraOrders locally only
+	MissingOrders []uint `json:"missingOrders"`
+	ExtraOrders   []uint `json:"extraOrders"`
+	// OutdatedCustomers and OutdatedOrders differ from their service
+	OutdatedCustomers []uint `json:"outdatedCustomers"`
+	OutdatedOrders    []uint `json:"outdatedOrders"`
+	// OrderProducts lists the orders whose products differ, missing orders
+	// included
+	OrderProducts []OrderProductsDiff `json:"orderProducts"`
+	Repaired      bool                `json:"repaired"`
+	// Unrepaired lists what the repair could not fix
+	Unrepaired []string `json:"unrepaired,omitempty"`
+}
+
+// OrderProductsDiff lists the products of an order that differ, one ID per unit
+type OrderProductsDiff struct {
+	OrderID uint `json:"orderId"`
+	// Missing products are ordered upstream but not linked locally
+	Missing []uint `json:"missing,omitempty"`
+	// Extra products are linked locally but no longer ordered
+	Extra []uint `json:"extra,omitempty"`
+}
+
+// Empty reports whether the mirrors match the services
+func (r Report) Empty() bool {
+	return len(r.MissingCustomers) == 0 && len(r.ExtraCustomers) == 0 &&
+		len(r.MissingOrders) == 0 && len(r.ExtraOrders) == 0 &&
+		len(r.OutdatedCustomers) == 0 && len(r.OutdatedOrders) == 0 &&
+		len(r.OrderProducts) == 0
+}
+
+// Local is the content of the local mirrors
+type Local struct {
+	Customers     []localModels.Customer
+	Orders        []localModels.Order
+	OrderProducts []localModels.OrderProduct
+}
+
+// Compare lists the differences between the local mirrors and the services.
+// The products of orders missing upstream are left out, as the order.deleted
+// handler leaves them too.
+func Compare(local Local, customers []models.Customer, orders []Order) Report {
+	var report Report
+
+	localCustomers := make(map[uint]localModels.Customer, len(local.Customers))
+	for _, customer := range local.Customers {
+		localCustomers[customer.ID] = customer
+	}
+	upstreamCustomers := make([]uint, len(customers))
+	for i, customer := range customers {
+		upstreamCustomers[i] = customer.ID
+		if known, ok := localCustomers[customer.ID]; ok && !sameCustomer(known, mirror.Customer(customer, known.SyncedAt)) {
+			report.OutdatedCustomers = append(report.OutdatedCustomers, customer.ID)
+		}
+	}
+	report.MissingCustomers, report.ExtraCustomers = difference(upstreamCustomers, slices.Collect(maps.Keys(localCustomers)))
+
+	localOrders := make(map[uint]localModels.Order, len(local.Orders))
+	for _, order := range local.Orders {
+		localOrders[order.ID] = order
+	}
+	upstreamOrders := make([]uint, len(orders))
+	for i, order := range orders {
+		upstreamOrders[i] = order.ID
+		if known, ok := localOrders[order.ID]; ok && known.CustomerID != order.CustomerID {
+			report.OutdatedOrders = append(report.OutdatedOrders, order.ID)
+		}
+	}
+	report.MissingOrders, report.ExtraOrders = difference(upstreamOrders, slices.Collect(maps.Keys(localOrders)))
+	slices.Sort(report.OutdatedCustomers)
+	slices.Sort(report.OutdatedOrders)
+
+	linked := make(map[uint][]uint)
+	for _, orderProduct := range local.OrderProducts {
+		linked[orderProduct.OrderID] = append(linked[orderProduct.OrderID], orderProduct.ProductID)
+	}
+	for _, order := range orders {
+		missing, extra := difference(order.ProductIDs, linked[order.ID])
+		if len(missing) > 0 || len(extra) > 0 {
+			report.OrderProducts = append(report.OrderProducts, OrderProductsDiff{OrderID: order.ID, Missing: missing, Extra: extra})
+		}
+	}
+	slices.SortFunc(report.OrderProducts, func(a, b OrderProductsDiff) int {
+		return cmp.Compare(a.OrderID, b.OrderID)
+	})
+
+	return report
+}
+
+// sameCustomer reports whether two customers have the same mirrored fields
+func sameCustomer(a, b localModels.Customer) bool {
+	return a.Username == b.Username && a.FirstName == b.FirstName && a.LastName == b.LastName &&
+		a.Name == b.Name && a.CompanyName == b.CompanyName
+}
+
+// difference returns the IDs of want missing from have and the extra ones,
+// sorted and counting duplicates
+func difference(want, have []uint) (missing, extra []uint) {
+	counts := make(map[uint]int)
+	for _, id := range want {
+		counts[id]++
+	}
+	for _, id := range have {
+		counts[id]--
+	}
+
+	for id, count := range counts {
+		for ; count > 0; count-- {
+			missing = append(missing, id)
+		}
+		for ; count < 0; count++ {
+			extra = append(extra, id)
+		}
+	}
+	slices.Sort(missing)
+	slices.Sort(extra)
+	return missing, extra
+}
+
+// ErrRepairRefused is returned when the differences found look like an
+// incomplete answer of the services rather than something to repair
+var ErrRepairRefused = errors.New("repair refused")
+
+// StockAlertPublisher publishes a stock alert raised by a repair
+type StockAlertPublisher func(ctx context.Context, eventType events.EventType, product localModels.Product) error
+
+// Reconciler compares the local mirrors with the services
+type Reconciler struct {
+	db                *gorm.DB
+	client            *Client
+	allocation        inventory.AllocationStrategy
+	maxDeletions      int
+	publishStockAlert StockAlertPublisher
+	logger            *slog.Logger
+}
+
+// New creates a reconciler taking the stock of missing order products with
+// the allocation strategy, and refusing repairs that would delete more than
+// maxDeletions customers and orders. The stock alerts of the repairs are
+// published once committed.
+func New(db *gorm.DB, client *Client, allocation inventory.AllocationStrategy, maxDeletions int, publishStockAlert StockAlertPublisher, logger *slog.Logger) *Reconciler {
+	return &Reconciler{
+		db:                db,
+		client:            client,
+		allocation:        allocation,
+		maxDeletions:      maxDeletions,
+		publishStockAlert: publishStockAlert,
+		logger:            logger,
+	}
+}
+
+// Reconcile compares the local mirrors with the services and, when repair is
+// set, fixes the differences
+func (r *Reconciler) Reconcile(ctx context.Context, repair bool) (Report, error) {
+	// Read the mirrors first: events handled meanwhile then show up as
+	// missing, which their handlers and the repair both tolerate, rather than
+	// as extra rows the repair would delete
+	local, err := r.local(ctx)
+	if err != nil {
+		return Report{}, fmt.Errorf("reading local mirrors: %w", err)
+	}
+	fetchedAt := time.Now()
+	customers, err := r.client.Customers(ctx)
+	if err != nil {
+		return Report{}, err
+	}
+	orders, err := r.client.Orders(ctx)
+	if err != nil {
+		return Report{}, err
+	}
+
+	report := Compare(local, customers, orders)
+	if repair && !report.Empty() {
+		if err := r.checkRepair(local, report, customers, orders); err != nil {
+			return report, err
+		}
+		report.Unrepaired, err = r.repair(ctx, report, upstream{customers, orders, fetchedAt})
+		if err != nil {
+			return report, fmt.Errorf("repairing: %w", err)
+		}
+		report.Repaired = true
+	}
+
+	r.logger.InfoContext(ctx, "Reconciled with the customer and order services",
+		slog.Int("missing_customers", len(report.MissingCustomers)),
+		slog.Int("extra_customers", len(report.ExtraCustomers)),
+		slog.Int("missing_orders", len(report.MissingOrders)),
+		slog.Int("extra_orders", len(report.ExtraOrders)),
+		slog.Int("outdated_customers", len(report.OutdatedCustomers)),
+		slog.Int("outdated_orders", len(report.OutdatedOrders)),
+		slog.Int("orders_with_product_differences", len(report.OrderProducts)),
+		slog.Bool("repaired", report.Repaired),
+		slog.Int("unrepaired", len(report.Unrepaired)),
+	)
+	return report, nil
+}
+
+// checkRepair refuses to repair when a service listed nothing while the
+// mirror is not empty, or when the repair would delete too much: an
+// unavailable service or a truncated list must not wipe the mirrors
+func (r *Reconciler) checkRepair(local Local, report Report, customers []models.Customer, orders []Order) error {
+	if len(customers) == 0 && len(local.Customers) > 0 {
+		return fmt.Errorf("%w: the customer service listed no customers while %d are mirrored", ErrRepairRefused, len(local.Customers))
+	}
+	if len(orders) == 0 && len(local.Orders) > 0 {
+		return fmt.Errorf("%w: the order service listed no orders while %d are mirrored", ErrRepairRefused, len(local.Orders))
+	}
+	if deletions := len(report.ExtraCustomers) + len(report.ExtraOrders); deletions > r.maxDeletions {
+		return fmt.Errorf("%w: %d customers and orders would be deleted, more than the %d allowed", ErrRepairRefused, deletions, r.maxDeletions)
+	}
+	return nil
+}
+
+// Run reconciles every interval until ctx is done
+func (r *Reconciler) Run(ctx context.Context, interval time.Duration, repair bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if _, err := r.Reconcile(ctx, repair); err != nil {
+			r.logger.ErrorContext(ctx, "Reconciliation failed", slog.Any("error", err))
+		}
+	}
+}
+
+// local reads the local mirrors
+func (r *Reconciler) local(ctx context.Context) (Local, error) {
+	var local Local
+	db := r.db.WithContext(ctx)
+
+	if err := db.Order("id").Find(&local.Customers).Error; err != nil {
+		return local, err
+	}
+	if err := db.Order("id").Find(&local.Orders).Error; err != nil {
+		return local, err
+	}
+	// Only the products of orders still there
+	err := db.Joins("JOIN orders ON orders.id = order_products.order_id AND orders.deleted_at IS NULL").
+		Order("order_products.id").
+		Find(&local.OrderProducts).Error
+	return local, err
+}
+
+// upstream is the content of the services as fetched at a time
+type upstream struct {
+	customers []models.Customer
+	orders    []Order
+	fetchedAt time.Time
+}
+
+// repair fixes the differences of a report, returning those it could not fix
+func (r *Reconciler) repair(ctx context.Context, report Report, upstream upstream) ([]string, error) {
+	db := r.db.WithContext(ctx)
+
+	var customers []localModels.Customer
+	for _, customer := range upstream.customers {
+		if slices.Contains(report.MissingCustomers, customer.ID) || slices.Contains(report.OutdatedCustomers, customer.ID) {
+			customers = append(customers, mirror.Customer(customer, upstream.fetchedAt))
+		}
+	}
+	if err := mirror.SaveCustomers(db, customers...); err != nil {
+		return nil, fmt.Errorf("saving customers: %w", err)
+	}
+	if err := undelete(db, &localModels.Customer{}, report.MissingCustomers); err != nil {
+		return nil, fmt.Errorf("restoring customers: %w", err)
+	}
+	if len(report.ExtraCustomers) > 0 {
+		if err := db.Delete(&localModels.Customer{}, report.ExtraCustomers).Error; err != nil {
+			return nil, fmt.Errorf("deleting customers: %w", err)
+		}
+	}
+
+	var orders []localModels.Order
+	for _, order := range upstream.orders {
+		if slices.Contains(report.MissingOrders, order.ID) || slices.Contains(report.OutdatedOrders, order.ID) {
+			orders = append(orders, mirror.Order(order.ID, order.CustomerID, upstream.fetchedAt))
+		}
+	}
+	if err := mirror.SaveOrders(db, orders...); err != nil {
+		return nil, fmt.Errorf("saving orders: %w", err)
+	}
+	if err := undelete(db, &localModels.Order{}, report.MissingOrders); err != nil {
+		return nil, fmt.Errorf("restoring orders: %w", err)
+	}
+	if len(report.ExtraOrders) > 0 {
+		if err := db.Delete(&localModels.Order{}, report.ExtraOrders).Error; err != nil {
+			return nil, fmt.Errorf("deleting orders: %w", err)
+		}
+	}
+
+	var unrepaired []string
+	for _, diff := range report.OrderProducts {
+		problems, err := r.repairOrderProducts(ctx, diff)
+		if err != nil {
+			return unrepaired, fmt.Errorf("order %d: %w", diff.OrderID, err)
+		}
+		unrepaired = append(unrepaired, problems...)
+	}
+	return unrepaired, nil
+}
+
+// undelete restores the soft-deleted rows of a model with the given IDs
+func undelete(db *gorm.DB, model any, ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return db.Unscoped().Model(model).Where("id IN ? AND deleted_at IS NOT NULL", ids).Update("deleted_at", nil).Error
+}
+
+// stockAlert is a stock alert waiting for its transaction to commit
+type stockAlert struct {
+	eventType events.EventType
+	product   localModels.Product
+}
+
+// repairOrderProducts links the missing products of an order, taking their
+// stock, and unlinks the extra ones, returning their stock to the warehouse
+// they came from. The stock alerts are published once committed, as the
+// order handler does.
+func (r *Reconciler) repairOrderProducts(ctx context.Context, diff OrderProductsDiff) ([]string, error) {
+	var unrepaired []string
+	var alerts []stockAlert
+	reference := fmt.Sprintf("order:%d", diff.OrderID)
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		unrepaired, alerts = nil, nil
+
+		// Lock the products in ID order, like the order handler
+		productIDs := slices.Concat(diff.Missing, diff.Extra)
+		slices.Sort(productIDs)
+		productIDs = slices.Compact(productIDs)
+		products := make(map[uint]*localModels.Product)
+		stockBefore := make(map[uint]uint)
+		for _, productID := range productIDs {
+			product, err := inventory.Lock(tx, productID)
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				unrepaired = append(unrepaired, fmt.Sprintf("order %d: product %d is unknown", diff.OrderID, productID))
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			products[productID] = &product
+			stockBefore[productID] = product.Stock
+		}
+
+		for _, productID := range diff.Extra {
+			var orderProduct localModels.OrderProduct
+			if err := tx.Where("order_id = ? AND product_id = ?", diff.OrderID, productID).Order("id DESC").First(&orderProduct).Error; err != nil {
+				return err
+			}
+			if err := tx.Delete(&orderProduct).Error; err != nil {
+				return err
+			}
+
+			product, ok := products[productID]
+			if !ok || orderProduct.WarehouseID == 0 {
+				continue
+			}
+			if err := inventory.Move(tx, product, orderProduct.WarehouseID, 1, inventory.ReasonReconciliation, reference); err != nil {
+				return err
+			}
+		}
+
+		for _, productID := range diff.Missing {
+			product, ok := products[productID]
+			if !ok {
+				continue
+			}
+
+			// Without stock left, the product is linked without taking any
+			warehouseID, err := inventory.Allocate(tx, product, 1, r.allocation, inventory.ReasonOrder, reference)
+			if errors.Is(err, inventory.ErrInsufficientStock) {
+				unrepaired = append(unrepaired, fmt.Sprintf("order %d: product %d has no stock left to take", diff.OrderID, productID))
+			} else if err != nil {
+				return err
+			}
+
+			orderProduct := localModels.OrderProduct{OrderID: diff.OrderID, ProductID: productID, WarehouseID: warehouseID}
+			if err := tx.Create(&orderProduct).Error; err != nil {
+				return err
+			}
+		}
+
+		// One alert per product, from its stock once every line is repaired
+		for _, productID := range productIDs {
+			product, ok := products[productID]
+			if !ok {
+				continue
+			}
+			if eventType, ok := localEvents.StockAlertFor(stockBefore[productID], product.Stock, product.ReorderThreshold); ok {
+				alerts = append(alerts, stockAlert{eventType: eventType, product: *product})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return unrepaired, err
+	}
+
+	for _, alert := range alerts {
+		if alert.eventType == localEvents.ProductOutOfStock {
+			metrics.StockOut(alert.product.ID)
+		}
+		if err := r.publishStockAlert(ctx, alert.eventType, alert.product); err != nil {
+			r.logger.ErrorContext(ctx, "Failed to publish stock alert",
+				slog.String("event_type", string(alert.eventType)),
+				slog.Uint64("product_id", uint64(alert.product.ID)),
+				slog.Any("error", err),
+			)
+		}
+	}
+	return unrepaired, nil
+}
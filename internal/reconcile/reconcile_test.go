@@ -0,0 +1,342 @@
+package reconcile_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/PayeTonKawa-EPSI-2025/Common-V2/events"
+	"github.com/PayeTonKawa-EPSI-2025/Common-V2/models"
+	localEvents "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/events"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/inventory"
+	localModels "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/models"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/reconcile"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// newStubServer serves the customer and order lists the way the services do
+func newStubServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /customers", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `{"customers":[{"ID":1,"name":"Ada"},{"ID":2,"name":"Grace"}]}`)
+	})
+	mux.HandleFunc("GET /orders", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `[{"ID":10,"customerId":1,"products":[{"ID":5},{"ID":5},{"ID":6}]},{"ID":11,"customerId":2,"productIds":[6]}]`)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestClient(t *testing.T) {
+	server := newStubServer(t)
+	client := reconcile.NewClient(server.Client(), server.URL+"/", server.URL)
+
+	customers, err := client.Customers(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(customers) != 2 || customers[1].ID != 2 || customers[1].Name != "Grace" {
+		t.Errorf("unexpected customers %+v", customers)
+	}
+
+	orders, err := client.Orders(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	want := []reconcile.Order{{ID: 10, CustomerID: 1, ProductIDs: []uint{5, 5, 6}}, {ID: 11, CustomerID: 2, ProductIDs: []uint{6}}}
+	if !reflect.DeepEqual(orders, want) {
+		t.Errorf("expected %+v, got %+v", want, orders)
+	}
+
+	broken := reconcile.NewClient(server.Client(), server.URL+"/missing", server.URL)
+	if _, err := broken.Customers(context.Background()); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("expected the unexpected status, got %v", err)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	local := reconcile.Local{
+		Customers: []localModels.Customer{customer(1, "Ada"), customer(3, "Edsger")},
+		Orders:    []localModels.Order{order(10, 1), order(12, 3)},
+		OrderProducts: []localModels.OrderProduct{
+			{OrderID: 10, ProductID: 5},
+			{OrderID: 10, ProductID: 7},
+			{OrderID: 12, ProductID: 5},
+		},
+	}
+	customers := []models.Customer{{Name: "Ada Lovelace"}, {Name: "Grace"}}
+	customers[0].ID, customers[1].ID = 1, 2
+	orders := []reconcile.Order{{ID: 10, CustomerID: 2, ProductIDs: []uint{5, 5, 6}}, {ID: 11, ProductIDs: []uint{6}}}
+
+	report := reconcile.Compare(local, customers, orders)
+
+	want := reconcile.Report{
+		MissingCustomers:  []uint{2},
+		ExtraCustomers:    []uint{3},
+		MissingOrders:     []uint{11},
+		ExtraOrders:       []uint{12},
+		OutdatedCustomers: []uint{1},
+		OutdatedOrders:    []uint{10},
+		OrderProducts: []reconcile.OrderProductsDiff{
+			{OrderID: 10, Missing: []uint{5, 6}, Extra: []uint{7}},
+			{OrderID: 11, Missing: []uint{6}},
+		},
+	}
+	if !reflect.DeepEqual(report, want) {
+		t.Errorf("expected %+v, got %+v", want, report)
+	}
+	if report.Empty() || !(reconcile.Report{}).Empty() {
+		t.Error("expected Empty to report differences")
+	}
+}
+
+func customer(id uint, name string) localModels.Customer {
+	c := localModels.Customer{Name: name}
+	c.ID = id
+	return c
+}
+
+func order(id, customerID uint) localModels.Order {
+	o := localModels.Order{CustomerID: customerID}
+	o.ID = id
+	return o
+}
+
+func setupMockDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	dbMock, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: dbMock}), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open gorm DB: %v", err)
+	}
+	return db, mock
+}
+
+// expectLocal expects the local mirrors to be read, holding the customers
+// and orders of the stub server with the given order products
+func expectLocal(mock sqlmock.Sqlmock, orderProducts *sqlmock.Rows) {
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "customers" WHERE "customers"."deleted_at" IS NULL ORDER BY id`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "Ada").AddRow(2, "Grace"))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "orders" WHERE "orders"."deleted_at" IS NULL ORDER BY id`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "customer_id"}).AddRow(10, 1).AddRow(11, 2))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "order_products"."id","order_products"."order_id","order_products"."product_id","order_products"."warehouse_id" FROM "order_products" JOIN orders`)).
+		WillReturnRows(orderProducts)
+}
+
+func newReconciler(db *gorm.DB, server *httptest.Server, maxDeletions int, publishStockAlert reconcile.StockAlertPublisher) *reconcile.Reconciler {
+	return reconcile.New(db, reconcile.NewClient(server.Client(), server.URL, server.URL),
+		inventory.AllocatePriority, maxDeletions, publishStockAlert, slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+// noAlerts drops the stock alerts of the repairs
+func noAlerts(ctx context.Context, eventType events.EventType, product localModels.Product) error {
+	return nil
+}
+
+func TestReconcileOnlyReports(t *testing.T) {
+	db, mock := setupMockDB(t)
+	expectLocal(mock, sqlmock.NewRows([]string{"id", "order_id", "product_id", "warehouse_id"}).
+		AddRow(1, 10, 5, 1).AddRow(2, 10, 6, 1).AddRow(3, 11, 6, 1))
+
+	reconciler := newReconciler(db, newStubServer(t), 100, noAlerts)
+
+	report, err := reconciler.Reconcile(context.Background(), false)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// Only the second unit of product 5 is missing, and nothing is written
+	want := []reconcile.OrderProductsDiff{{OrderID: 10, Missing: []uint{5}}}
+	if !reflect.DeepEqual(report.OrderProducts, want) || len(report.MissingOrders) != 0 || len(report.OutdatedCustomers) != 0 || report.Repaired {
+		t.Errorf("unexpected report %+v", report)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled sqlmock expectations: %v", err)
+	}
+}
+
+func TestClientFollowsPagination(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /customers", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "2" {
+			_, _ = io.WriteString(w, `[{"ID":2}]`)
+			return
+		}
+		w.Header().Set("Link", `</customers?page=2>; rel="next", </customers?page=2>; rel="last"`)
+		_, _ = io.WriteString(w, `[{"ID":1}]`)
+	})
+	mux.HandleFunc("GET /orders", func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("page") {
+		case "":
+			_, _ = io.WriteString(w, `{"orders":[{"ID":10}],"next":"/orders?page=2"}`)
+		case "2":
+			_, _ = io.WriteString(w, `{"orders":[{"ID":11}],"next":"?page=3"}`)
+		default:
+			_, _ = io.WriteString(w, `{"orders":[{"ID":12}],"next":null}`)
+		}
+	})
+	mux.HandleFunc("GET /loop/customers", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", `</loop/customers>; rel="next"`)
+		_, _ = io.WriteString(w, `[]`)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := reconcile.NewClient(server.Client(), server.URL, server.URL)
+
+	customers, err := client.Customers(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(customers) != 2 || customers[0].ID != 1 || customers[1].ID != 2 {
+		t.Errorf("expected both pages of customers, got %+v", customers)
+	}
+
+	orders, err := client.Orders(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(orders) != 3 || orders[2].ID != 12 {
+		t.Errorf("expected the three pages of orders, got %+v", orders)
+	}
+
+	looping := reconcile.NewClient(server.Client(), server.URL+"/loop", server.URL)
+	if _, err := looping.Customers(context.Background()); err == nil || !strings.Contains(err.Error(), "loops") {
+		t.Errorf("expected the pagination loop to be reported, got %v", err)
+	}
+}
+
+func TestReconcileRefusesUnsafeRepairs(t *testing.T) {
+	cases := []struct {
+		name         string
+		customers    string
+		orders       string
+		maxDeletions int
+	}{
+		{"no customers listed", `[]`, `[{"ID":10,"customerId":1},{"ID":11,"customerId":2}]`, 100},
+		{"null orders", `{"customers":[{"ID":1,"name":"Ada"},{"ID":2,"name":"Grace"}]}`, `{"orders":null}`, 100},
+		{"too many deletions", `{"customers":[{"ID":1,"name":"Ada"}]}`, `[{"ID":10,"customerId":1}]`, 1},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock := setupMockDB(t)
+			expectLocal(mock, sqlmock.NewRows([]string{"id", "order_id", "product_id", "warehouse_id"}))
+
+			mux := http.NewServeMux()
+			mux.HandleFunc("GET /customers", func(w http.ResponseWriter, r *http.Request) {
+				_, _ = io.WriteString(w, tc.customers)
+			})
+			mux.HandleFunc("GET /orders", func(w http.ResponseWriter, r *http.Request) {
+				_, _ = io.WriteString(w, tc.orders)
+			})
+			server := httptest.NewServer(mux)
+			t.Cleanup(server.Close)
+
+			// Any write would fail as unexpected by sqlmock
+			report, err := newReconciler(db, server, tc.maxDeletions, noAlerts).Reconcile(context.Background(), true)
+			if !errors.Is(err, reconcile.ErrRepairRefused) {
+				t.Fatalf("expected the repair to be refused, got %v", err)
+			}
+			if report.Repaired || report.Empty() {
+				t.Errorf("expected the differences to be reported only, got %+v", report)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unfulfilled sqlmock expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestReconcileRepairsOrderProducts(t *testing.T) {
+	db, mock := setupMockDB(t)
+	// Order 10 misses the second unit of product 5 and links product 7 it
+	// no longer has, taken from warehouse 2. The last unit of product 5 is
+	// taken, running it out of stock.
+	expectLocal(mock, sqlmock.NewRows([]string{"id", "order_id", "product_id", "warehouse_id"}).
+		AddRow(1, 10, 5, 1).AddRow(2, 10, 6, 1).AddRow(3, 10, 7, 2).AddRow(4, 11, 6, 1))
+
+	productRows := func(id, stock int) *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "name", "stock", "status"}).AddRow(id, "Product", stock, "active")
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "products" WHERE "products"."id" = $1 AND "products"."deleted_at" IS NULL ORDER BY "products"."id" LIMIT $2 FOR UPDATE`)).
+		WithArgs(5, 1).
+		WillReturnRows(productRows(5, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "products" WHERE "products"."id" = $1 AND "products"."deleted_at" IS NULL ORDER BY "products"."id" LIMIT $2 FOR UPDATE`)).
+		WithArgs(7, 1).
+		WillReturnRows(productRows(7, 0))
+
+	// Product 7 is unlinked and its unit returned to warehouse 2
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "order_products" WHERE order_id = $1 AND product_id = $2 ORDER BY id DESC`)).
+		WithArgs(10, 7, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "order_id", "product_id", "warehouse_id"}).AddRow(3, 10, 7, 2))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "order_products" WHERE "order_products"."id" = $1`)).
+		WithArgs(3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "warehouse_stocks" ("warehouse_id","product_id","quantity") VALUES ($1,$2,$3) ON CONFLICT ("warehouse_id","product_id") DO UPDATE SET "quantity"=warehouse_stocks.quantity + $4`)).
+		WithArgs(2, 7, 1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "products" SET "stock"=stock + $1 WHERE id = $2`)).
+		WithArgs(1, 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "stock_movements"`)).
+		WithArgs(7, 2, 1, inventory.ReasonReconciliation, "order:10", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	// The missing unit of product 5 is taken from the first warehouse by priority
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "warehouse_stocks"."id","warehouse_stocks"."warehouse_id","warehouse_stocks"."product_id","warehouse_stocks"."quantity" FROM "warehouse_stocks" JOIN warehouses ON warehouses.id = warehouse_stocks.warehouse_id AND warehouses.deleted_at IS NULL WHERE warehouse_stocks.product_id = $1 AND warehouse_stocks.quantity >= $2 ORDER BY warehouses.priority, warehouses.id`)).
+		WithArgs(5, 1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "warehouse_id", "product_id", "quantity"}).AddRow(4, 1, 5, 3))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "warehouse_stocks" SET "quantity"=quantity + $1 WHERE warehouse_id = $2 AND product_id = $3 AND quantity >= $4`)).
+		WithArgs(-1, 1, 5, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "products" SET "stock"=stock + $1 WHERE id = $2`)).
+		WithArgs(-1, 5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "stock_movements"`)).
+		WithArgs(5, 1, -1, inventory.ReasonOrder, "order:10", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "order_products" ("order_id","product_id","warehouse_id") VALUES ($1,$2,$3)`)).
+		WithArgs(10, 5, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+	mock.ExpectCommit()
+
+	var alerts []string
+	publish := func(ctx context.Context, eventType events.EventType, product localModels.Product) error {
+		alerts = append(alerts, fmt.Sprintf("%s %d %d", eventType, product.ID, product.Stock))
+		return nil
+	}
+
+	report, err := newReconciler(db, newStubServer(t), 100, publish).Reconcile(context.Background(), true)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if want := []string{fmt.Sprintf("%s 5 0", localEvents.ProductOutOfStock)}; !reflect.DeepEqual(alerts, want) {
+		t.Errorf("expected alerts %v, got %v", want, alerts)
+	}
+
+	want := []reconcile.OrderProductsDiff{{OrderID: 10, Missing: []uint{5}, Extra: []uint{7}}}
+	if !reflect.DeepEqual(report.OrderProducts, want) || !report.Repaired || len(report.Unrepaired) != 0 {
+		t.Errorf("unexpected report %+v", report)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled sqlmock expectations: %v", err)
+	}
+}
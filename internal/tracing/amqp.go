@@ -0,0 +1,59 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel"
+)
+
+// AMQPHeaders adapts AMQP message headers to a propagation carrier
+type AMQPHeaders amqp.Table
+
+// Get returns the header value as a string
+func (h AMQPHeaders) Get(key string) string {
+	switch v := h[key].(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Set stores a header value
+func (h AMQPHeaders) Set(key, value string) {
+	h[key] = value
+}
+
+// Keys lists the header names
+func (h AMQPHeaders) Keys() []string {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// InjectAMQP writes the trace context of ctx into the message headers,
+// creating them if needed
+func InjectAMQP(ctx context.Context, headers amqp.Table) amqp.Table {
+	if headers == nil {
+		headers = amqp.Table{}
+	}
+	otel.GetTextMapPropagator().Inject(ctx, AMQPHeaders(headers))
+	return headers
+}
+
+// ExtractAMQP returns a context carrying the trace context found in the
+// message headers
+func ExtractAMQP(ctx context.Context, headers amqp.Table) context.Context {
+	if headers == nil {
+		return ctx
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, AMQPHeaders(headers))
+}
@@ -0,0 +1,46 @@
+package tracing
+
+import (
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Middleware starts a server span for every Huma operation, continuing the
+// trace of the caller when the request carries a traceparent header
+func Middleware(ctx huma.Context, next func(huma.Context)) {
+	headers := http.Header{}
+	ctx.EachHeader(func(name, value string) {
+		headers.Add(name, value)
+	})
+	parent := otel.GetTextMapPropagator().Extract(ctx.Context(), propagation.HeaderCarrier(headers))
+
+	op := ctx.Operation()
+	u := ctx.URL()
+	spanCtx, span := Tracer().Start(parent, op.Method+" "+op.Path,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("http.request.method", op.Method),
+			attribute.String("http.route", op.Path),
+			attribute.String("url.path", u.Path),
+			attribute.String("huma.operation_id", op.OperationID),
+		),
+	)
+	defer span.End()
+
+	next(huma.WithContext(ctx, spanCtx))
+
+	status := ctx.Status()
+	if status == 0 {
+		status = http.StatusOK
+	}
+	span.SetAttributes(attribute.Int("http.response.status_code", status))
+	if status >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+}
@@ -0,0 +1,136 @@
+package tracing_test
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/tracing"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/danielgtaylor/huma/v2/humatest"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func TestParseExporter(t *testing.T) {
+	exporter, err := tracing.ParseExporter("")
+	if err != nil || exporter != tracing.ExporterNone {
+		t.Errorf("expected none by default, got %q, %v", exporter, err)
+	}
+
+	exporter, err = tracing.ParseExporter("otlp")
+	if err != nil || exporter != tracing.ExporterOTLP {
+		t.Errorf("expected otlp, got %q, %v", exporter, err)
+	}
+
+	if _, err := tracing.ParseExporter("jaeger"); err == nil {
+		t.Error("expected an error for an unknown exporter")
+	}
+}
+
+func setupRecorder(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { _ = provider.Shutdown(context.Background()) })
+	return recorder
+}
+
+func TestAMQPPropagation(t *testing.T) {
+	setupRecorder(t)
+
+	ctx, span := tracing.Tracer().Start(context.Background(), "publish")
+	headers := tracing.InjectAMQP(ctx, amqp.Table{"x-correlation-id": "abc"})
+	span.End()
+
+	if _, ok := headers["traceparent"]; !ok {
+		t.Fatalf("expected traceparent header, got %v", headers)
+	}
+	if headers["x-correlation-id"] != "abc" {
+		t.Errorf("expected existing headers to be kept, got %v", headers)
+	}
+
+	extracted := trace.SpanContextFromContext(tracing.ExtractAMQP(context.Background(), headers))
+	if extracted.TraceID() != span.SpanContext().TraceID() {
+		t.Errorf("expected trace ID %s, got %s", span.SpanContext().TraceID(), extracted.TraceID())
+	}
+	if !extracted.IsRemote() {
+		t.Error("expected extracted span context to be remote")
+	}
+}
+
+func TestGormPluginRecordsQueries(t *testing.T) {
+	recorder := setupRecorder(t)
+
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open gorm DB: %v", err)
+	}
+	if err := db.Use(tracing.GormPlugin{}); err != nil {
+		t.Fatalf("failed to register plugin: %v", err)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "products"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+
+	ctx, parent := tracing.Tracer().Start(context.Background(), "request")
+	var count int64
+	if err := db.WithContext(ctx).Table("products").Count(&count).Error; err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	query := spans[0]
+	if query.Name() != "gorm.query" {
+		t.Errorf("expected gorm.query span, got %s", query.Name())
+	}
+	if query.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Error("expected the query span to be a child of the request span")
+	}
+}
+
+func TestMiddlewareCreatesServerSpan(t *testing.T) {
+	recorder := setupRecorder(t)
+
+	_, api := humatest.New(t)
+	api.UseMiddleware(tracing.Middleware)
+	huma.Get(api, "/products/{id}", func(ctx context.Context, input *struct {
+		ID uint `path:"id"`
+	}) (*struct{}, error) {
+		return nil, huma.Error404NotFound("Product not found")
+	})
+
+	resp := api.Get("/products/1", "traceparent: 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if resp.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", resp.Code)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "GET /products/{id}" {
+		t.Errorf("unexpected span name %s", span.Name())
+	}
+	if span.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("expected the incoming trace to be continued, got %s", span.SpanContext().TraceID())
+	}
+}
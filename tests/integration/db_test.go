@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/PayeTonKawa-EPSI-2025/Common-V2/models"
+	localModels "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/models"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
@@ -45,28 +46,34 @@ func ResetProductsTable(t *testing.T, db *gorm.DB) {
 func SeedDB(t *testing.T, db *gorm.DB) {
 	t.Helper()
 
-	if err := db.AutoMigrate(&models.Product{}); err != nil {
+	if err := db.AutoMigrate(&localModels.Product{}); err != nil {
 		t.Fatalf("failed to auto migrate: %v", err)
 	}
 
-	products := []models.Product{
+	products := []localModels.Product{
 		{
-			Name:  "Product A",
-			Stock: 55,
-			Details: models.ProductDetails{
-				Price:       4.2,
-				Description: "This is product A",
-				Color:       "Blue",
+			Product: models.Product{
+				Name:  "Product A",
+				Stock: 55,
+				Details: models.ProductDetails{
+					Price:       4.2,
+					Description: "This is product A",
+					Color:       "Blue",
+				},
 			},
+			Status: localModels.ProductStatusActive,
 		},
 		{
-			Name:  "Product B",
-			Stock: 42,
-			Details: models.ProductDetails{
-				Price:       5.3,
-				Description: "This is product B",
-				Color:       "Red",
+			Product: models.Product{
+				Name:  "Product B",
+				Stock: 42,
+				Details: models.ProductDetails{
+					Price:       5.3,
+					Description: "This is product B",
+					Color:       "Red",
+				},
 			},
+			Status: localModels.ProductStatusActive,
 		},
 	}
 
@@ -0,0 +1,108 @@
+package integration_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/PayeTonKawa-EPSI-2025/Common-V2/models"
+	"github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/db"
+	localModels "github.com/PayeTonKawa-EPSI-2025/Products-V2/internal/models"
+	"gorm.io/gorm"
+)
+
+// Tables as the first release created them with AutoMigrate
+type baselineCustomer struct {
+	gorm.Model
+}
+
+func (baselineCustomer) TableName() string { return "customers" }
+
+type baselineOrder struct {
+	gorm.Model
+}
+
+func (baselineOrder) TableName() string { return "orders" }
+
+type baselineOrderProduct struct {
+	ID        uint `gorm:"primaryKey"`
+	OrderID   uint
+	Order     baselineOrder `gorm:"foreignKey:OrderID"`
+	ProductID uint
+	Product   models.Product `gorm:"foreignKey:ProductID"`
+}
+
+func (baselineOrderProduct) TableName() string { return "order_products" }
+
+// BaselineSchema creates the schema of the first release in an empty
+// Postgres schema of its own, dropped when the test ends
+func BaselineSchema(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	conn := ConnectDB(t)
+	// A single connection keeps the search_path for every statement
+	sqlDB, _ := conn.DB()
+	sqlDB.SetMaxOpenConns(1)
+
+	schema := fmt.Sprintf("migrate_baseline_%d", time.Now().UnixNano())
+	if err := conn.Exec(fmt.Sprintf(`CREATE SCHEMA %q`, schema)).Error; err != nil {
+		t.Fatalf("failed to create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		conn.Exec(fmt.Sprintf(`DROP SCHEMA %q CASCADE`, schema))
+		sqlDB.Close()
+	})
+	if err := conn.Exec(fmt.Sprintf(`SET search_path TO %q`, schema)).Error; err != nil {
+		t.Fatalf("failed to set search_path: %v", err)
+	}
+
+	err := conn.AutoMigrate(&models.Product{}, &baselineCustomer{}, &baselineOrder{}, &baselineOrderProduct{})
+	if err != nil {
+		t.Fatalf("failed to create baseline schema: %v", err)
+	}
+
+	return conn
+}
+
+func TestMigrateUpFromBaselineSchema(t *testing.T) {
+	conn := BaselineSchema(t)
+
+	existing := models.Product{Name: "Product A", Stock: 12}
+	if err := conn.Create(&existing).Error; err != nil {
+		t.Fatalf("failed to seed product: %v", err)
+	}
+
+	migrator, err := db.NewMigrator(conn)
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("failed to migrate the baseline schema: %v", err)
+	}
+
+	pending, err := migrator.Pending(context.Background())
+	if err != nil {
+		t.Fatalf("failed to list pending migrations: %v", err)
+	}
+	if len(pending) != 0 {
+		t.Errorf("expected no pending migration, got %+v", pending)
+	}
+
+	for _, column := range []string{"status", "reorder_threshold"} {
+		if !conn.Migrator().HasColumn(&localModels.Product{}, column) {
+			t.Errorf("expected products.%s to be added", column)
+		}
+	}
+	if !conn.Migrator().HasColumn(&localModels.OrderProduct{}, "warehouse_id") {
+		t.Error("expected order_products.warehouse_id to be added")
+	}
+
+	var product localModels.Product
+	if err := conn.First(&product, existing.ID).Error; err != nil {
+		t.Fatalf("failed to load the existing product: %v", err)
+	}
+	if product.Status != localModels.ProductStatusActive {
+		t.Errorf("expected the existing product to be active, got %q", product.Status)
+	}
+}
@@ -12,7 +12,7 @@ func TestIntegration_GetProducts(t *testing.T) {
 	ResetProductsTable(t, db)
 	SeedDB(t, db)
 
-	resp, err := operation.GetProducts(context.Background(), db)
+	resp, err := operation.GetProducts(context.Background(), db, "active")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}